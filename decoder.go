@@ -5,8 +5,11 @@ package fcpxml
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,9 +17,85 @@ import (
 	"github.com/Avalanche-io/gotio"
 )
 
+// timeTolerance is the difference in seconds below which two record
+// positions are considered equal.
+const timeTolerance = 1e-9
+
+// retimeTolerance is how far, in seconds, the points of a time map may stray
+// from a straight line and still be treated as a constant speed.
+const retimeTolerance = 1e-6
+
+// defaultMaxCompoundDepth is how deeply compound clips are expanded when
+// DecoderOptions.MaxCompoundDepth is not set.
+const defaultMaxCompoundDepth = 16
+
+// DecoderOptions configures how a Decoder converts FCPX XML.
+type DecoderOptions struct {
+	// AllowOverlaps reports overlapping spine items as warnings instead of
+	// failing the decode. An overlapping item is placed directly after the
+	// item it overlaps.
+	AllowOverlaps bool
+
+	// MaxCompoundDepth limits how deeply compound clips nested inside other
+	// compound clips are expanded. Zero uses a default of 16.
+	MaxCompoundDepth int
+
+	// AuditionPick selects which clip of each audition is decoded, counting
+	// from the active pick at 0. Auditions with fewer clips use their active
+	// pick. A pick longer than the active pick is trimmed to its duration.
+	AuditionPick int
+
+	// AudioTracks selects how the sequence's audio is grouped onto tracks:
+	// by lane, the default, or by audio role or subrole.
+	AudioTracks TrackGrouping
+
+	// VideoTracks selects how the sequence's video is grouped onto tracks:
+	// by lane, the default, or by video role or subrole.
+	VideoTracks TrackGrouping
+}
+
+// TrackGrouping selects how decoded items are grouped onto OTIO tracks.
+type TrackGrouping int
+
+const (
+	// GroupByLane places items on a track per FCPX lane.
+	GroupByLane TrackGrouping = iota
+
+	// GroupByRole places items on a track per role, such as Dialogue or
+	// Titles, named after the role. Items overlapping within a role spill
+	// onto further tracks, such as "Dialogue 2".
+	GroupByRole
+
+	// GroupBySubrole places items on a track per subrole, such as
+	// Dialogue-1, named after the subrole.
+	GroupBySubrole
+)
+
 // Decoder reads FCPX XML and decodes it into an OTIO Timeline.
 type Decoder struct {
-	r io.Reader
+	r    io.Reader
+	opts DecoderOptions
+
+	// assets, effects, formats and media index the document's resources
+	// by id.
+	assets  map[string]*Asset
+	effects map[string]*Effect
+	formats map[string]*Format
+	media   map[string]*Media
+
+	// frameDuration is the frame duration of the project's sequence, which
+	// sets the rate of decoded times. It is zero when the sequence has no
+	// format.
+	frameDuration Time
+
+	// syncClips counts the sync-clips decoded, to group their clips.
+	syncClips int
+
+	// expanding holds the ids of the compound clips being expanded, outermost
+	// first.
+	expanding []string
+
+	warnings []string
 }
 
 // NewDecoder creates a new Decoder that reads from r.
@@ -24,6 +103,16 @@ func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{r: r}
 }
 
+// SetOptions sets the options used by subsequent calls to Decode.
+func (d *Decoder) SetOptions(opts DecoderOptions) {
+	d.opts = opts
+}
+
+// Warnings returns the problems tolerated during the last call to Decode.
+func (d *Decoder) Warnings() []string {
+	return d.warnings
+}
+
 // Decode reads the FCPX XML document and converts it to an OTIO Timeline.
 func (d *Decoder) Decode() (*gotio.Timeline, error) {
 	var fcpxml FCPXML
@@ -60,8 +149,29 @@ func (d *Decoder) convertToTimeline(fcpxml *FCPXML) (*gotio.Timeline, error) {
 		return nil, fmt.Errorf("no project found in FCPX XML")
 	}
 
+	// Index resources so clips can resolve their refs
+	d.indexResources(fcpxml.Resources)
+	if err := d.setFrameDuration(project.Sequence); err != nil {
+		return nil, err
+	}
+	d.warnings = nil
+	d.syncClips = 0
+	d.expanding = nil
+
 	// Create timeline
-	timeline := gotio.NewTimeline(project.Name, nil, nil)
+	var globalStart *opentime.RationalTime
+	metadata := make(map[string]interface{})
+	if project.Sequence != nil {
+		var err error
+		globalStart, err = d.convertSequenceSettings(project.Sequence, metadata)
+		if err != nil {
+			return nil, err
+		}
+		if fcpx := convertNotes(project.Sequence.Note, project.Sequence.Metadata); fcpx != nil {
+			metadata["fcpx"] = fcpx
+		}
+	}
+	timeline := gotio.NewTimeline(project.Name, globalStart, metadata)
 
 	// Convert sequence to tracks
 	if project.Sequence != nil {
@@ -73,65 +183,253 @@ func (d *Decoder) convertToTimeline(fcpxml *FCPXML) (*gotio.Timeline, error) {
 	return timeline, nil
 }
 
+// indexResources builds the lookup tables used to resolve resource refs.
+func (d *Decoder) indexResources(resources *Resources) {
+	d.assets = make(map[string]*Asset)
+	d.effects = make(map[string]*Effect)
+	d.formats = make(map[string]*Format)
+	d.media = make(map[string]*Media)
+	if resources == nil {
+		return
+	}
+	for _, asset := range resources.Assets {
+		d.assets[asset.ID] = asset
+	}
+	for _, effect := range resources.Effects {
+		d.effects[effect.ID] = effect
+	}
+	for _, format := range resources.Formats {
+		d.formats[format.ID] = format
+	}
+	for _, media := range resources.Media {
+		d.media[media.ID] = media
+	}
+}
+
+// setFrameDuration looks up the frame duration of the sequence's format.
+func (d *Decoder) setFrameDuration(seq *Sequence) error {
+	d.frameDuration = Time{}
+	if seq == nil {
+		return nil
+	}
+	format, ok := d.formats[seq.Format]
+	if !ok || format.FrameDuration == "" {
+		return nil
+	}
+
+	frameDuration, err := ParseTime(format.FrameDuration)
+	if err != nil {
+		return fmt.Errorf("failed to parse format frameDuration: %w", err)
+	}
+	if !frameDuration.IsZero() {
+		d.frameDuration = frameDuration
+	}
+	return nil
+}
+
+// convertSequenceSettings records the sequence's format and timecode
+// settings in timeline metadata and returns its start timecode, if any.
+func (d *Decoder) convertSequenceSettings(seq *Sequence, metadata map[string]interface{}) (*opentime.RationalTime, error) {
+	if format, ok := d.formats[seq.Format]; ok {
+		metadata["fcpx_format"] = map[string]interface{}{
+			"id":             format.ID,
+			"name":           format.Name,
+			"frame_duration": format.FrameDuration,
+			"width":          format.Width,
+			"height":         format.Height,
+			"color_space":    format.ColorSpace,
+		}
+	}
+	if seq.TCFormat != "" {
+		metadata["fcpx_tc_format"] = seq.TCFormat
+		metadata["fcpx_drop_frame"] = seq.TCFormat == "DF"
+	}
+	if seq.AudioLayout != "" {
+		metadata["fcpx_audio_layout"] = seq.AudioLayout
+	}
+	if seq.AudioRate != "" {
+		metadata["fcpx_audio_rate"] = seq.AudioRate
+	}
+
+	if seq.TCStart == "" {
+		return nil, nil
+	}
+	tcStart, err := d.parseRationalTime(seq.TCStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sequence tcStart: %w", err)
+	}
+	return &tcStart, nil
+}
+
 // convertSequenceToTracks converts a FCPX Sequence to OTIO tracks.
 func (d *Decoder) convertSequenceToTracks(seq *Sequence, timeline *gotio.Timeline) error {
 	if seq.Spine == nil {
 		return nil
 	}
 
-	// FCPX uses a single spine, which we'll convert to separate video and audio tracks
-	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
-	audioTrack := gotio.NewTrack("Audio 1", nil, gotio.TrackKindAudio, nil, nil)
+	// FCPX uses a single spine with connected lanes, which we'll convert to
+	// separate video and audio tracks per lane. The spine starts at the
+	// sequence's start timecode.
+	tracks := newLaneTracks()
+	if start := timeline.GlobalStartTime(); start != nil {
+		tracks.origin = *start
+	}
+	if _, err := d.convertSpine(seq.Spine, tracks); err != nil {
+		return err
+	}
+	if d.opts.VideoTracks != GroupByLane {
+		d.groupByRole(tracks, d.opts.VideoTracks, true)
+	}
+	if d.opts.AudioTracks != GroupByLane {
+		d.groupByRole(tracks, d.opts.AudioTracks, false)
+	}
+
+	// Add tracks to timeline
+	return d.layoutTracks(tracks, timeline.Tracks())
+}
 
-	// Process spine items
-	for _, item := range seq.Spine.Items {
-		switch v := item.(type) {
-		case *Clip:
-			// Convert clip to OTIO clips (may create both video and audio)
-			if err := d.convertClip(v, videoTrack, audioTrack); err != nil {
-				return err
-			}
-		case *Video:
-			// Video-only clip
-			if err := d.convertVideo(v, videoTrack); err != nil {
-				return err
+// convertSpine converts the items of a storyline onto tracks and returns the
+// record time at which the storyline ends.
+func (d *Decoder) convertSpine(spine *Spine, tracks *laneTracks) (opentime.RationalTime, error) {
+	// Items without an offset follow directly after the previous item
+	position := tracks.origin
+	end := position
+	for _, item := range spine.Items {
+		attrs := storyAttributes(item)
+
+		duration, err := d.parseRationalTime(attrs.duration)
+		if err != nil {
+			return end, fmt.Errorf("failed to parse spine item duration: %w", err)
+		}
+
+		offset := position
+		if attrs.offset != "" {
+			offset, err = d.parseRationalTime(attrs.offset)
+			if err != nil {
+				return end, fmt.Errorf("failed to parse spine item offset: %w", err)
 			}
-		case *Audio:
-			// Audio-only clip
-			if err := d.convertAudio(v, audioTrack); err != nil {
-				return err
+		}
+
+		// Transitions overlap their neighbours rather than taking up time.
+		// The cut they span is where the previous item ended.
+		if transition, ok := item.(*Transition); ok {
+			if attrs.offset == "" {
+				// Without an offset the transition is centred on the cut
+				half := opentime.NewRationalTime(duration.Value()/2, duration.Rate())
+				offset = subTime(position, half)
 			}
-		case *Gap:
-			// Gap/filler
-			if err := d.convertGap(v, videoTrack, audioTrack); err != nil {
-				return err
+			if err := d.convertTransition(transition, offset, position, 0, tracks); err != nil {
+				return end, err
 			}
-		case *Transition:
-			// Transitions are stored as metadata on adjacent clips
-			// For now, skip direct processing
 			continue
-		case *RefClip:
-			// Compound clip reference
-			if err := d.convertRefClip(v, videoTrack, audioTrack); err != nil {
-				return err
-			}
+		}
+
+		if err := d.convertStoryElement(item, offset, 0, tracks); err != nil {
+			return end, err
+		}
+
+		position = addTime(offset, duration)
+		if position.ToSeconds() > end.ToSeconds() {
+			end = position
 		}
 	}
 
-	// Add tracks to timeline
-	tracks := timeline.Tracks()
-	if len(videoTrack.Children()) > 0 {
-		tracks.AppendChild(videoTrack)
+	return end, nil
+}
+
+// convertStoryElement converts a story element starting at the record
+// position offset on the given lane, along with the items connected to it.
+func (d *Decoder) convertStoryElement(item interface{}, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	var err error
+	switch v := item.(type) {
+	case *Clip:
+		// Convert clip to OTIO clips (may create both video and audio)
+		err = d.convertClip(v, offset, lane, tracks)
+	case *Video:
+		// Video-only clip
+		err = d.convertVideo(v, offset, lane, tracks)
+	case *Audio:
+		// Audio-only clip
+		err = d.convertAudio(v, offset, lane, tracks)
+	case *Title:
+		// Title, converted to a generator clip
+		err = d.convertTitle(v, offset, lane, tracks)
+	case *Caption:
+		// Caption, placed on a caption track for its role whatever its lane
+		err = d.convertCaption(v, offset, tracks)
+	case *Gap:
+		// Gap/filler
+		err = d.convertGap(v, offset, lane, tracks)
+	case *Transition:
+		// Transitions only occur between storyline items, see convertSpine
+		return nil
+	case *RefClip:
+		// Compound clip reference
+		err = d.convertRefClip(v, offset, lane, tracks)
+	case *MCClip:
+		// Multicam clip reference
+		err = d.convertMCClip(v, offset, lane, tracks)
+	case *SyncClip:
+		// Synced clip, which converts its connected items itself
+		return d.convertSyncClip(v, offset, lane, tracks)
+	case *Audition:
+		// Audition, converted through its pick
+		return d.convertAudition(v, offset, lane, tracks)
+	case *Spine:
+		// Secondary storyline
+		err = d.convertStoryline(v, offset, lane, tracks)
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.convertConnected(item, offset, lane, tracks)
+}
+
+// convertConnected converts the items connected to a story element. Their
+// offsets are in the parent's local time, which begins at the parent's start,
+// and their lanes are relative to the parent's lane.
+func (d *Decoder) convertConnected(parent interface{}, parentOffset opentime.RationalTime, parentLane int, tracks *laneTracks) error {
+	attrs := storyAttributes(parent)
+	if len(attrs.connected) == 0 {
+		return nil
+	}
+
+	// Offsets are taken from the parent's start exactly, before converting
+	// to OTIO time
+	parentStart, err := parseOptionalTime(attrs.start)
+	if err != nil {
+		return fmt.Errorf("failed to parse start: %w", err)
 	}
-	if len(audioTrack.Children()) > 0 {
-		tracks.AppendChild(audioTrack)
+
+	for _, item := range attrs.connected {
+		itemAttrs := storyAttributes(item)
+		if itemAttrs.lane == "" {
+			// Items without a lane are part of the parent's own content
+			continue
+		}
+
+		lane, err := strconv.Atoi(itemAttrs.lane)
+		if err != nil {
+			return fmt.Errorf("invalid lane %q: %w", itemAttrs.lane, err)
+		}
+
+		itemOffset, err := parseOptionalTime(itemAttrs.offset)
+		if err != nil {
+			return fmt.Errorf("failed to parse connected item offset: %w", err)
+		}
+
+		offset := addTime(parentOffset, d.rationalTime(itemOffset.Sub(parentStart)))
+		if err := d.convertStoryElement(item, offset, parentLane+lane, tracks); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 // convertClip converts a FCPX Clip to OTIO clip(s).
-func (d *Decoder) convertClip(clip *Clip, videoTrack, audioTrack *gotio.Track) error {
+func (d *Decoder) convertClip(clip *Clip, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
 	// Parse duration
 	duration, err := d.parseRationalTime(clip.Duration)
 	if err != nil {
@@ -147,38 +445,164 @@ func (d *Decoder) convertClip(clip *Clip, videoTrack, audioTrack *gotio.Track) e
 		}
 	}
 
-	// Create source range
-	sourceRange := opentime.NewTimeRange(start, duration)
-
 	// Convert markers
-	var markers []*gotio.Marker
-	for _, m := range clip.Markers {
-		marker, err := d.convertMarker(m)
-		if err != nil {
-			return err
+	markers, err := d.convertMarkers(clip.Markers, clip.ChapterMarkers, clip.Keywords, clip.Ratings)
+	if err != nil {
+		return err
+	}
+
+	// Asset clips carry the asset ref directly, clip elements on the
+	// video and audio that make up their content
+	video, audio := clipEssence(clip)
+	videoRef, audioRef := clip.Ref, clip.Ref
+	if clip.Ref == "" {
+		if video != nil {
+			videoRef, audioRef = video.Ref, video.Ref
+		}
+		if audio != nil {
+			audioRef = audio.Ref
 		}
-		markers = append(markers, marker)
+	}
+
+	hasVideo := video != nil || clip.Ref != ""
+	hasAudio := audio != nil || clip.AudioDuration != ""
+	if asset, ok := d.assets[clip.Ref]; ok && (asset.HasVideo != "" || asset.HasAudio != "") {
+		// An asset that declares its essence knows which an asset-clip
+		// actually uses. Older and hand-written assets often declare
+		// neither, leaving the essence inferred from the clip.
+		hasVideo = asset.HasVideo == "1"
+		hasAudio = asset.HasAudio == "1"
+	}
+	switch clip.SrcEnable {
+	case "video":
+		hasAudio = false
+	case "audio":
+		hasVideo = false
+	}
+
+	// The clip's own roles apply to all of its video and audio
+	videoRole := clip.VideoRole
+	if videoRole == "" && video != nil {
+		videoRole = video.Role
+	}
+	role := clip.AudioRole
+	if role == "" && audio != nil {
+		role = audioRole(audio)
 	}
 
 	// Create video clip if present
-	if clip.Video != nil || clip.Ref != "" {
-		ref := gotio.NewExternalReference("", "", nil, nil)
-		otioClip := gotio.NewClip(clip.Name, ref, &sourceRange, nil, nil, markers, "", nil)
-		videoTrack.AppendChild(otioClip)
+	if hasVideo {
+		ref, err := d.convertMediaReference(videoRef)
+		if err != nil {
+			return err
+		}
+		effects, sourceStart, metadata, err := d.convertRetiming(clip.TimeMap, clip.ConformRate, start)
+		if err != nil {
+			return err
+		}
+		if fcpx := convertNotes(clip.Note, clip.Metadata); fcpx != nil {
+			metadata["fcpx"] = fcpx
+		}
+		if videoRole != "" {
+			metadata["fcpx_video_role"] = videoRole
+		}
+		if hasAudio && role != "" {
+			metadata["fcpx_audio_role"] = role
+		}
+		effects = append(effects, d.convertFilterEffects(clip.FilterVideos, nil)...)
+		sourceRange := opentime.NewTimeRange(sourceStart, duration)
+		otioClip := gotio.NewClip(clip.Name, ref, &sourceRange, metadata, effects, markers, "", nil)
+		tracks.place(tracks.videoTrack(lane), otioClip, offset, duration)
 	}
 
 	// Create audio clip if present
-	if clip.Audio != nil || clip.AudioDuration != "" {
-		ref := gotio.NewExternalReference("", "", nil, nil)
-		otioClip := gotio.NewClip(clip.Name, ref, &sourceRange, nil, nil, markers, "", nil)
-		audioTrack.AppendChild(otioClip)
+	if hasAudio {
+		ref, err := d.convertMediaReference(audioRef)
+		if err != nil {
+			return err
+		}
+		effects, sourceStart, metadata, err := d.convertRetiming(clip.TimeMap, clip.ConformRate, start)
+		if err != nil {
+			return err
+		}
+		if fcpx := convertNotes(clip.Note, clip.Metadata); fcpx != nil {
+			metadata["fcpx"] = fcpx
+		}
+		if role != "" {
+			metadata["fcpx_audio_role"] = role
+		}
+		effects = append(effects, d.convertFilterEffects(nil, clip.FilterAudios)...)
+		sourceRange := opentime.NewTimeRange(sourceStart, duration)
+		otioClip := gotio.NewClip(clip.Name, ref, &sourceRange, metadata, effects, markers, "", nil)
+		tracks.place(tracks.audioTrack(lane), otioClip, offset, duration)
 	}
 
 	return nil
 }
 
+// clipEssence returns the video and audio elements that make up a clip's
+// own media. Clips holding detached audio nest it inside their content, so
+// when a clip has no video or audio child of its own the content is searched.
+func clipEssence(clip *Clip) (*Video, *Audio) {
+	var video *Video
+	var audio *Audio
+	if clip.Video != nil && clip.Video.Lane == "" {
+		video = clip.Video
+	}
+	if clip.Audio != nil && clip.Audio.Lane == "" {
+		audio = clip.Audio
+	}
+	if video != nil || audio != nil {
+		return video, audio
+	}
+
+	for _, item := range clip.Items {
+		if storyAttributes(item).lane != "" {
+			continue
+		}
+		nestedVideo, nestedAudio := findEssence([]interface{}{item})
+		if video == nil {
+			video = nestedVideo
+		}
+		if audio == nil {
+			audio = nestedAudio
+		}
+	}
+
+	return video, audio
+}
+
+// findEssence returns the first video and audio elements found in items or
+// anywhere below them.
+func findEssence(items []interface{}) (*Video, *Audio) {
+	var video *Video
+	var audio *Audio
+	for _, item := range items {
+		switch v := item.(type) {
+		case *Video:
+			if video == nil {
+				video = v
+			}
+		case *Audio:
+			if audio == nil {
+				audio = v
+			}
+		}
+
+		nestedVideo, nestedAudio := findEssence(storyAttributes(item).connected)
+		if video == nil {
+			video = nestedVideo
+		}
+		if audio == nil {
+			audio = nestedAudio
+		}
+	}
+
+	return video, audio
+}
+
 // convertVideo converts a FCPX Video element to OTIO clip.
-func (d *Decoder) convertVideo(video *Video, videoTrack *gotio.Track) error {
+func (d *Decoder) convertVideo(video *Video, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
 	duration, err := d.parseRationalTime(video.Duration)
 	if err != nil {
 		return fmt.Errorf("failed to parse video duration: %w", err)
@@ -192,27 +616,40 @@ func (d *Decoder) convertVideo(video *Video, videoTrack *gotio.Track) error {
 		}
 	}
 
-	sourceRange := opentime.NewTimeRange(start, duration)
+	effects, sourceStart, metadata, err := d.convertRetiming(video.TimeMap, video.ConformRate, start)
+	if err != nil {
+		return err
+	}
+	if video.Role != "" {
+		metadata["fcpx_video_role"] = video.Role
+	}
+	effects = append(effects, d.convertFilterEffects(video.FilterVideos, nil)...)
+	sourceRange := opentime.NewTimeRange(sourceStart, duration)
 
 	// Convert markers
-	var markers []*gotio.Marker
-	for _, m := range video.Markers {
-		marker, err := d.convertMarker(m)
+	markers, err := d.convertMarkers(video.Markers, video.ChapterMarkers, video.Keywords, video.Ratings)
+	if err != nil {
+		return err
+	}
+
+	// Video referencing an effect rather than an asset is a generator
+	var ref gotio.MediaReference
+	if _, ok := d.effects[video.Ref]; ok {
+		ref = d.convertGenerator(video.Ref, video.Name, "video", video.Params, nil)
+	} else {
+		ref, err = d.convertMediaReference(video.Ref)
 		if err != nil {
 			return err
 		}
-		markers = append(markers, marker)
 	}
-
-	ref := gotio.NewExternalReference("", "", nil, nil)
-	otioClip := gotio.NewClip(video.Name, ref, &sourceRange, nil, nil, markers, "", nil)
-	videoTrack.AppendChild(otioClip)
+	otioClip := gotio.NewClip(video.Name, ref, &sourceRange, metadata, effects, markers, "", nil)
+	tracks.place(tracks.videoTrack(lane), otioClip, offset, duration)
 
 	return nil
 }
 
 // convertAudio converts a FCPX Audio element to OTIO clip.
-func (d *Decoder) convertAudio(audio *Audio, audioTrack *gotio.Track) error {
+func (d *Decoder) convertAudio(audio *Audio, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
 	duration, err := d.parseRationalTime(audio.Duration)
 	if err != nil {
 		return fmt.Errorf("failed to parse audio duration: %w", err)
@@ -226,145 +663,1884 @@ func (d *Decoder) convertAudio(audio *Audio, audioTrack *gotio.Track) error {
 		}
 	}
 
-	sourceRange := opentime.NewTimeRange(start, duration)
+	effects, sourceStart, metadata, err := d.convertRetiming(audio.TimeMap, nil, start)
+	if err != nil {
+		return err
+	}
+	if role := audioRole(audio); role != "" {
+		metadata["fcpx_audio_role"] = role
+	}
+	effects = append(effects, d.convertFilterEffects(nil, audio.FilterAudios)...)
+	sourceRange := opentime.NewTimeRange(sourceStart, duration)
 
-	ref := gotio.NewExternalReference("", "", nil, nil)
-	otioClip := gotio.NewClip(audio.Name, ref, &sourceRange, nil, nil, nil, "", nil)
-	audioTrack.AppendChild(otioClip)
+	ref, err := d.convertMediaReference(audio.Ref)
+	if err != nil {
+		return err
+	}
+	otioClip := gotio.NewClip(audio.Name, ref, &sourceRange, metadata, effects, nil, "", nil)
+	tracks.place(tracks.audioTrack(lane), otioClip, offset, duration)
 
 	return nil
 }
 
-// convertGap converts a FCPX Gap to OTIO gap(s).
-func (d *Decoder) convertGap(gap *Gap, videoTrack, audioTrack *gotio.Track) error {
-	duration, err := d.parseRationalTime(gap.Duration)
+// audioRole returns the role of an audio element, or of its first channel
+// with one.
+func audioRole(audio *Audio) string {
+	if audio.Role != "" {
+		return audio.Role
+	}
+	for _, channel := range audio.Channels {
+		if channel.Role != "" {
+			return channel.Role
+		}
+	}
+	return ""
+}
+
+// convertTitle converts a FCPX Title to an OTIO clip with a
+// GeneratorReference for the title's effect, holding its text.
+func (d *Decoder) convertTitle(title *Title, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	duration, err := d.parseRationalTime(title.Duration)
 	if err != nil {
-		return fmt.Errorf("failed to parse gap duration: %w", err)
+		return fmt.Errorf("failed to parse title duration: %w", err)
 	}
 
-	sourceRange := opentime.NewTimeRange(opentime.RationalTime{}, duration)
+	var start opentime.RationalTime
+	if title.Start != "" {
+		start, err = d.parseRationalTime(title.Start)
+		if err != nil {
+			return fmt.Errorf("failed to parse title start: %w", err)
+		}
+	}
 
-	// Add gap to both tracks
-	videoGap := gotio.NewGap(gap.Name, &sourceRange, nil, nil, nil, nil)
-	audioGap := gotio.NewGap(gap.Name, &sourceRange, nil, nil, nil, nil)
+	ref := d.convertGenerator(title.Ref, title.Name, "title", title.Params, title)
 
-	videoTrack.AppendChild(videoGap)
-	audioTrack.AppendChild(audioGap)
+	metadata := make(map[string]interface{})
+	if title.Role != "" {
+		metadata["fcpx_video_role"] = title.Role
+	}
+	effects := d.convertFilterEffects(title.FilterVideos, nil)
+	sourceRange := opentime.NewTimeRange(start, duration)
+	otioClip := gotio.NewClip(title.Name, ref, &sourceRange, metadata, effects, nil, "", nil)
+	tracks.place(tracks.videoTrack(lane), otioClip, offset, duration)
 
 	return nil
 }
 
-// convertMarker converts a FCPX Marker to OTIO Marker.
-func (d *Decoder) convertMarker(marker *Marker) (*gotio.Marker, error) {
-	start, err := d.parseRationalTime(marker.Start)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse marker start: %w", err)
-	}
-
-	var duration opentime.RationalTime
-	if marker.Duration != "" {
-		duration, err = d.parseRationalTime(marker.Duration)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse marker duration: %w", err)
+// convertGenerator builds the GeneratorReference for a title or generator
+// element using the effect with id ref. The effect's name is the generator
+// kind; its uid, the element's params and a title's text are the
+// parameters. The element's name is recorded in "fcpx_element" metadata.
+func (d *Decoder) convertGenerator(ref, name, element string, params []*Param, title *Title) *gotio.GeneratorReference {
+	kind := name
+	parameters := make(map[string]interface{})
+	if effect, ok := d.effects[ref]; ok {
+		kind = effect.Name
+		if effect.UID != "" {
+			parameters["effect_uid"] = effect.UID
 		}
 	}
+	if len(params) > 0 {
+		parameters["params"] = convertParams(params)
+	}
 
-	markedRange := opentime.NewTimeRange(start, duration)
-
-	// Use marker value as name, note as comment
-	name := marker.Value
-	comment := marker.Note
+	if title != nil {
+		convertText(title.Texts, title.TextStyleDefs, parameters)
+	}
 
-	return gotio.NewMarker(name, markedRange, gotio.MarkerColorGreen, comment, nil), nil
+	metadata := map[string]interface{}{"fcpx_element": element}
+	return gotio.NewGeneratorReference(kind, kind, nil, parameters, metadata)
 }
 
-// convertRefClip converts a FCPX RefClip (compound clip) to OTIO Stack.
-func (d *Decoder) convertRefClip(refClip *RefClip, videoTrack, audioTrack *gotio.Track) error {
-	// Parse duration
-	duration, err := d.parseRationalTime(refClip.Duration)
-	if err != nil {
-		return fmt.Errorf("failed to parse ref-clip duration: %w", err)
+// convertText records the text of a title or caption in generator
+// parameters: "text" holds the plain text and "text_styles" its runs, each
+// with the attributes of the style definition it uses.
+func convertText(texts []*Text, styleDefs []*TextStyleDef, parameters map[string]interface{}) {
+	if len(texts) == 0 {
+		return
 	}
 
-	// Parse start time
-	var start opentime.RationalTime
-	if refClip.Start != "" {
-		start, err = d.parseRationalTime(refClip.Start)
-		if err != nil {
-			return fmt.Errorf("failed to parse ref-clip start: %w", err)
+	// Runs take their attributes from the style definitions they use
+	defs := make(map[string]*TextStyle)
+	for _, def := range styleDefs {
+		if def.TextStyle != nil {
+			defs[def.ID] = def.TextStyle
 		}
 	}
 
-	// Create source range
-	sourceRange := opentime.NewTimeRange(start, duration)
+	// Separate text elements become lines, the break ending the last run of
+	// the line before
+	var content strings.Builder
+	var runs []interface{}
+	for i, text := range texts {
+		if i > 0 && len(runs) > 0 {
+			content.WriteString("\n")
+			last := runs[len(runs)-1].(map[string]interface{})
+			last["text"] = last["text"].(string) + "\n"
+		}
+		for _, style := range text.TextStyles {
+			content.WriteString(style.Text)
+			run := map[string]interface{}{"text": style.Text}
+			if def, ok := defs[style.Ref]; ok {
+				for key, value := range map[string]string{
+					"font":             def.Font,
+					"font_size":        def.FontSize,
+					"font_face":        def.FontFace,
+					"font_color":       def.FontColor,
+					"background_color": def.BackgroundColor,
+					"bold":             def.Bold,
+					"italic":           def.Italic,
+					"alignment":        def.Alignment,
+					"line_spacing":     def.LineSpacing,
+				} {
+					if value != "" {
+						run[key] = value
+					}
+				}
+			}
+			runs = append(runs, run)
+		}
+	}
+	parameters["text"] = content.String()
+	parameters["text_styles"] = runs
+}
 
-	// Convert markers
-	var markers []*gotio.Marker
-	for _, m := range refClip.Markers {
-		marker, err := d.convertMarker(m)
+// convertCaption converts a FCPX Caption to an OTIO clip with a
+// GeneratorReference of kind "Caption" holding its text, display
+// attributes and caption format, placed on the caption track for its role.
+func (d *Decoder) convertCaption(caption *Caption, offset opentime.RationalTime, tracks *laneTracks) error {
+	duration, err := d.parseRationalTime(caption.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse caption duration: %w", err)
+	}
+
+	var start opentime.RationalTime
+	if caption.Start != "" {
+		start, err = d.parseRationalTime(caption.Start)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to parse caption start: %w", err)
 		}
-		markers = append(markers, marker)
 	}
 
-	// Create a Stack to represent the compound clip
-	// In Python adapter, ref-clips become nested Stacks
-	stack := gotio.NewStack(refClip.Name, &sourceRange, nil, nil, markers, nil)
-
-	// Add metadata for compound clip reference
-	metadata := map[string]interface{}{
-		"fcpx_ref": refClip.Ref,
+	parameters := make(map[string]interface{})
+	if format := captionFormat(caption.Role); format != "" {
+		parameters["caption_format"] = format
 	}
-	if refClip.SrcEnable != "" {
-		metadata["fcpx_src_enable"] = refClip.SrcEnable
+	if len(caption.Texts) > 0 {
+		// Display attributes are the same for every line of a caption
+		text := caption.Texts[0]
+		for key, value := range map[string]string{
+			"display_style":  text.DisplayStyle,
+			"roll_up_height": text.RollUpHeight,
+			"position":       text.Position,
+			"placement":      text.Placement,
+			"alignment":      text.Alignment,
+		} {
+			if value != "" {
+				parameters[key] = value
+			}
+		}
 	}
-	stack.SetMetadata(metadata)
+	convertText(caption.Texts, caption.TextStyleDefs, parameters)
+	ref := gotio.NewGeneratorReference("Caption", "Caption", nil, parameters, map[string]interface{}{"fcpx_element": "caption"})
 
-	// Add to appropriate track based on srcEnable attribute
-	if refClip.SrcEnable == "audio" {
-		audioTrack.AppendChild(stack)
-	} else {
-		videoTrack.AppendChild(stack)
+	metadata := make(map[string]interface{})
+	if caption.Role != "" {
+		metadata["fcpx_caption_role"] = caption.Role
 	}
+	sourceRange := opentime.NewTimeRange(start, duration)
+	otioClip := gotio.NewClip(caption.Name, ref, &sourceRange, metadata, nil, nil, "", nil)
+	tracks.place(tracks.captionTrack(caption.Role), otioClip, offset, duration)
 
 	return nil
 }
 
-// parseRationalTime parses FCPX rational time format (e.g., "1001/30000s").
-func (d *Decoder) parseRationalTime(s string) (opentime.RationalTime, error) {
-	if s == "" {
-		return opentime.RationalTime{}, nil
+// captionFormat returns the caption format and language of a caption role,
+// such as "ITT.en" for "iTT?captionFormat=ITT.en", or "" if it has none.
+func captionFormat(role string) string {
+	if i := strings.Index(role, "captionFormat="); i >= 0 {
+		return role[i+len("captionFormat="):]
 	}
+	return ""
+}
 
-	// Remove trailing 's' if present
-	s = strings.TrimSuffix(s, "s")
+// convertMediaReference builds the media reference for the asset with the
+// given id. Refs that don't resolve to an asset yield an empty reference.
+func (d *Decoder) convertMediaReference(assetRef string) (*gotio.ExternalReference, error) {
+	asset, ok := d.assets[assetRef]
+	if !ok {
+		return gotio.NewExternalReference("", "", nil, nil), nil
+	}
 
-	// Split on '/'
-	parts := strings.Split(s, "/")
-	if len(parts) != 2 {
-		// Try parsing as a simple number (frames at default rate)
-		value, err := strconv.ParseFloat(s, 64)
+	// The asset's start/duration describe the media that is available
+	var availableRange *opentime.TimeRange
+	if asset.Duration != "" {
+		duration, err := d.parseRationalTime(asset.Duration)
 		if err != nil {
-			return opentime.RationalTime{}, fmt.Errorf("invalid rational time format: %s", s)
+			return nil, fmt.Errorf("failed to parse asset duration: %w", err)
 		}
-		return opentime.NewRationalTime(value, 24), nil
+
+		var start opentime.RationalTime
+		if asset.Start != "" {
+			start, err = d.parseRationalTime(asset.Start)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse asset start: %w", err)
+			}
+		}
+
+		r := opentime.NewTimeRange(start, duration)
+		availableRange = &r
 	}
 
-	// Parse numerator (value in frames)
-	value, err := strconv.ParseFloat(parts[0], 64)
+	// Keep the asset attributes so the reference can be traced back
+	metadata := map[string]interface{}{
+		"fcpx_asset_id": asset.ID,
+	}
+	for key, value := range map[string]string{
+		"fcpx_asset_uid":      asset.UID,
+		"fcpx_format":         asset.Format,
+		"fcpx_has_video":      asset.HasVideo,
+		"fcpx_has_audio":      asset.HasAudio,
+		"fcpx_audio_sources":  asset.AudioSources,
+		"fcpx_audio_channels": asset.AudioChannels,
+		"fcpx_audio_rate":     asset.AudioRate,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	if fcpx := convertNotes(nil, asset.Metadata); fcpx != nil {
+		metadata["fcpx"] = fcpx
+	}
+
+	return gotio.NewExternalReference(asset.Name, assetSource(asset), availableRange, metadata), nil
+}
+
+// convertNotes converts an element's note and metadata to the value kept
+// under the "fcpx" metadata key, or nil when it has neither. Each md entry
+// is kept by its key, with array values as lists of strings.
+func convertNotes(note *Note, md *Metadata) map[string]interface{} {
+	fcpx := make(map[string]interface{})
+	if note != nil && note.Text != "" {
+		fcpx["note"] = note.Text
+	}
+	if md != nil && len(md.MD) > 0 {
+		entries := make(map[string]interface{})
+		for _, entry := range md.MD {
+			if entry.Array == nil {
+				entries[entry.Key] = entry.Value
+				continue
+			}
+			values := make([]interface{}, len(entry.Array.Strings))
+			for i, value := range entry.Array.Strings {
+				values[i] = value
+			}
+			entries[entry.Key] = values
+		}
+		fcpx["metadata"] = entries
+	}
+	if len(fcpx) == 0 {
+		return nil
+	}
+	return fcpx
+}
+
+// assetSource returns the URL of an asset's media. Assets before FCPXML 1.9
+// give it in their src attribute, later ones in a media-rep, preferring the
+// original media over proxies.
+func assetSource(asset *Asset) string {
+	if asset.Src != "" {
+		return asset.Src
+	}
+	for _, rep := range asset.MediaReps {
+		if rep.Kind == "" || rep.Kind == "original-media" {
+			return rep.Src
+		}
+	}
+	if len(asset.MediaReps) > 0 {
+		return asset.MediaReps[0].Src
+	}
+	return ""
+}
+
+// convertGap converts a FCPX Gap to OTIO gap(s).
+func (d *Decoder) convertGap(gap *Gap, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	// Gaps in connected lanes only hold space, which layout fills anyway
+	if lane != 0 {
+		return nil
+	}
+
+	duration, err := d.parseRationalTime(gap.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse gap duration: %w", err)
+	}
+
+	sourceRange := opentime.NewTimeRange(opentime.RationalTime{}, duration)
+
+	// Add gap to both tracks
+	videoGap := gotio.NewGap(gap.Name, &sourceRange, nil, nil, nil, nil)
+	audioGap := gotio.NewGap(gap.Name, &sourceRange, nil, nil, nil, nil)
+
+	tracks.place(tracks.videoTrack(lane), videoGap, offset, duration)
+	tracks.place(tracks.audioTrack(lane), audioGap, offset, duration)
+
+	return nil
+}
+
+// convertTransition converts a FCPX Transition to an OTIO Transition placed at
+// the cut it spans. The in and out offsets are how far the transition reaches
+// into the items before and after the cut.
+func (d *Decoder) convertTransition(transition *Transition, offset, cut opentime.RationalTime, lane int, tracks *laneTracks) error {
+	duration, err := d.parseRationalTime(transition.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse transition duration: %w", err)
+	}
+
+	inOffset := subTime(cut, offset)
+	if inOffset.ToSeconds() < 0 {
+		inOffset = opentime.NewRationalTime(0, duration.Rate())
+	} else if inOffset.ToSeconds() > duration.ToSeconds() {
+		inOffset = duration
+	}
+	outOffset := subTime(duration, inOffset)
+
+	// Map the effect to an OTIO transition type
+	name := transition.Name
+	if transition.FilterVideo != nil {
+		name = transition.FilterVideo.Name
+		if effect, ok := d.effects[transition.FilterVideo.Ref]; ok {
+			name = effect.Name
+		}
+	}
+	transitionType := gotio.TransitionTypeCustom
+	if name == "Cross Dissolve" {
+		transitionType = gotio.TransitionTypeSMPTEDissolve
+	}
+
+	// Keep the filters so the transition can be written back
+	metadata := map[string]interface{}{}
+	if transition.FilterVideo != nil {
+		metadata["fcpx_filter_video"] = d.convertFilter(transition.FilterVideo.Ref, transition.FilterVideo.Name, transition.FilterVideo.Params)
+	}
+	if transition.FilterAudio != nil {
+		metadata["fcpx_filter_audio"] = d.convertFilter(transition.FilterAudio.Ref, transition.FilterAudio.Name, transition.FilterAudio.Params)
+	}
+
+	otioTransition := gotio.NewTransition(transition.Name, transitionType, inOffset, outOffset, metadata)
+
+	// Audio-only transitions belong on the audio track
+	track := tracks.videoTrack(lane)
+	if transition.FilterVideo == nil && transition.FilterAudio != nil {
+		track = tracks.audioTrack(lane)
+	}
+	tracks.place(track, otioTransition, cut, opentime.NewRationalTime(0, cut.Rate()))
+
+	return nil
+}
+
+// convertFilter converts a FCPX filter to metadata, resolving its effect.
+func (d *Decoder) convertFilter(ref, name string, params []*Param) map[string]interface{} {
+	filter := map[string]interface{}{
+		"ref":  ref,
+		"name": name,
+	}
+	if effect, ok := d.effects[ref]; ok {
+		filter["effect_name"] = effect.Name
+		filter["effect_uid"] = effect.UID
+	}
+
+	if len(params) > 0 {
+		filter["params"] = convertParams(params)
+	}
+
+	return filter
+}
+
+// convertParams converts FCPX params to a list of metadata values. An
+// animated param's keyframes are kept under "keyframes", and nested params
+// under "params".
+func convertParams(params []*Param) []interface{} {
+	values := make([]interface{}, 0, len(params))
+	for _, param := range params {
+		value := map[string]interface{}{
+			"name":  param.Name,
+			"key":   param.Key,
+			"value": param.Value,
+		}
+		if param.Enabled != "" {
+			value["enabled"] = param.Enabled
+		}
+		if param.KeyframeAnimation != nil {
+			keyframes := make([]interface{}, 0, len(param.KeyframeAnimation.Keyframes))
+			for _, keyframe := range param.KeyframeAnimation.Keyframes {
+				keyframes = append(keyframes, map[string]interface{}{
+					"time":   keyframe.Time,
+					"value":  keyframe.Value,
+					"interp": keyframe.Interp,
+					"curve":  keyframe.Curve,
+				})
+			}
+			value["keyframes"] = keyframes
+		}
+		if len(param.Params) > 0 {
+			value["params"] = convertParams(param.Params)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// convertFilterEffects converts the filters applied to a clip to OTIO
+// Effects, named after the filter and the effect it uses. As for
+// transitions, each filter is kept in "fcpx_filter_video" or
+// "fcpx_filter_audio" metadata so that it can be written back.
+func (d *Decoder) convertFilterEffects(videoFilters []*FilterVideo, audioFilters []*FilterAudio) []gotio.Effect {
+	var effects []gotio.Effect
+	add := func(key, ref, name, enabled string, params []*Param) {
+		filter := d.convertFilter(ref, name, params)
+		if enabled != "" {
+			filter["enabled"] = enabled
+		}
+		effectName := name
+		if effect, ok := d.effects[ref]; ok {
+			effectName = effect.Name
+		}
+		effects = append(effects, gotio.NewEffect(name, effectName, map[string]interface{}{key: filter}))
+	}
+	for _, filter := range videoFilters {
+		add("fcpx_filter_video", filter.Ref, filter.Name, filter.Enabled, filter.Params)
+	}
+	for _, filter := range audioFilters {
+		add("fcpx_filter_audio", filter.Ref, filter.Name, filter.Enabled, filter.Params)
+	}
+	return effects
+}
+
+// convertMarkers converts a FCPX element's markers, chapter markers, keywords
+// and ratings to OTIO Markers.
+func (d *Decoder) convertMarkers(markers []*Marker, chapters []*ChapterMarker, keywords []*Keyword, ratings []*Rating) ([]*gotio.Marker, error) {
+	var result []*gotio.Marker
+	for _, m := range markers {
+		marker, err := d.convertMarker(m)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, marker)
+	}
+	for _, c := range chapters {
+		marker, err := d.convertChapterMarker(c)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, marker)
+	}
+	for _, k := range keywords {
+		marker, err := d.convertKeyword(k)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, marker)
+	}
+	for _, r := range ratings {
+		marker, err := d.convertRating(r)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, marker)
+	}
+	return result, nil
+}
+
+// convertMarker converts a FCPX Marker to OTIO Marker. To-do markers are red
+// until completed and green after, standard markers are purple.
+func (d *Decoder) convertMarker(marker *Marker) (*gotio.Marker, error) {
+	markedRange, err := d.convertMarkedRange(marker.Start, marker.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	color := gotio.MarkerColorPurple
+	kind := "standard"
+	switch {
+	case marker.Completed:
+		color = gotio.MarkerColorGreen
+		kind = "todo"
+	case marker.ToDo:
+		color = gotio.MarkerColorRed
+		kind = "todo"
+	}
+	metadata := map[string]interface{}{"fcpx_marker_kind": kind}
+
+	// Use marker value as name, note as comment
+	return gotio.NewMarker(marker.Value, markedRange, color, marker.Note, metadata), nil
+}
+
+// convertChapterMarker converts a FCPX ChapterMarker to an orange OTIO Marker,
+// keeping its poster frame offset in metadata.
+func (d *Decoder) convertChapterMarker(marker *ChapterMarker) (*gotio.Marker, error) {
+	markedRange, err := d.convertMarkedRange(marker.Start, marker.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{"fcpx_marker_kind": "chapter"}
+	if marker.PosterOffset != "" {
+		metadata["fcpx_poster_offset"] = marker.PosterOffset
+	}
+
+	return gotio.NewMarker(marker.Value, markedRange, gotio.MarkerColorOrange, marker.Note, metadata), nil
+}
+
+// convertKeyword converts a FCPX Keyword to a blue OTIO Marker over the
+// keyword's range, named by its comma separated keywords.
+func (d *Decoder) convertKeyword(keyword *Keyword) (*gotio.Marker, error) {
+	markedRange, err := d.convertMarkedRange(keyword.Start, keyword.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{"fcpx_marker_kind": "keyword"}
+
+	return gotio.NewMarker(keyword.Value, markedRange, gotio.MarkerColorBlue, keyword.Note, metadata), nil
+}
+
+// convertRating converts a FCPX Rating to an OTIO Marker over the rated range,
+// yellow for favorites and black for rejects.
+func (d *Decoder) convertRating(rating *Rating) (*gotio.Marker, error) {
+	markedRange, err := d.convertMarkedRange(rating.Start, rating.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	color := gotio.MarkerColorYellow
+	if rating.Value == "reject" {
+		color = gotio.MarkerColorBlack
+	}
+	metadata := map[string]interface{}{
+		"fcpx_marker_kind": "rating",
+		"fcpx_rating":      rating.Value,
+	}
+
+	name := rating.Name
+	if name == "" {
+		name = rating.Value
+	}
+
+	return gotio.NewMarker(name, markedRange, color, rating.Note, metadata), nil
+}
+
+// convertMarkedRange parses a marker's start and duration.
+func (d *Decoder) convertMarkedRange(startValue, durationValue string) (opentime.TimeRange, error) {
+	start, err := d.parseRationalTime(startValue)
+	if err != nil {
+		return opentime.TimeRange{}, fmt.Errorf("failed to parse marker start: %w", err)
+	}
+
+	var duration opentime.RationalTime
+	if durationValue != "" {
+		duration, err = d.parseRationalTime(durationValue)
+		if err != nil {
+			return opentime.TimeRange{}, fmt.Errorf("failed to parse marker duration: %w", err)
+		}
+	}
+
+	return opentime.NewTimeRange(start, duration), nil
+}
+
+// convertRetiming converts a clip's timeMap and conform-rate. Constant speed
+// maps become a LinearTimeWarp, or a FreezeFrame for a hold. Variable speed
+// ramps have no OTIO equivalent and are kept in the "fcpx_time_map" metadata,
+// and the conform-rate in "fcpx_conform_rate". It also returns the source
+// time the clip starts at, which is start mapped through the timeMap.
+func (d *Decoder) convertRetiming(timeMap *TimeMap, conformRate *ConformRate, start opentime.RationalTime) ([]gotio.Effect, opentime.RationalTime, map[string]interface{}, error) {
+	metadata := make(map[string]interface{})
+	if conformRate != nil {
+		metadata["fcpx_conform_rate"] = map[string]interface{}{
+			"scale_enabled":  conformRate.ScaleEnabled,
+			"src_frame_rate": conformRate.SrcFrameRate,
+			"frame_sampling": conformRate.FrameSampling,
+		}
+	}
+	if timeMap == nil || len(timeMap.TimePoints) == 0 {
+		return nil, start, metadata, nil
+	}
+
+	// Parse the map into clip time and source time pairs, kept exact for
+	// mapping and in seconds for finding the speed
+	points := make([]Time, len(timeMap.TimePoints))
+	mapped := make([]Time, len(timeMap.TimePoints))
+	times := make([]float64, len(timeMap.TimePoints))
+	values := make([]float64, len(timeMap.TimePoints))
+	for i, point := range timeMap.TimePoints {
+		t, err := ParseTime(point.Time)
+		if err != nil {
+			return nil, start, nil, fmt.Errorf("failed to parse timept time: %w", err)
+		}
+		v, err := ParseTime(point.Value)
+		if err != nil {
+			return nil, start, nil, fmt.Errorf("failed to parse timept value: %w", err)
+		}
+		points[i], mapped[i] = t, v
+		times[i], values[i] = t.Seconds(), v.Seconds()
+	}
+
+	// Map the clip's start through the time map
+	var clipStart Time
+	if start.Rate() > 0 {
+		clipStart = TimeFromRationalTime(start)
+	}
+	sourceStart := d.rationalTime(mapTime(points, mapped, clipStart))
+
+	effectMetadata := make(map[string]interface{})
+	if timeMap.FrameSampling != "" {
+		effectMetadata["fcpx_frame_sampling"] = timeMap.FrameSampling
+	}
+	if timeMap.PreservesPitch != "" {
+		effectMetadata["fcpx_preserves_pitch"] = timeMap.PreservesPitch
+	}
+
+	scalar, constant := timeMapScalar(times, values)
+	switch {
+	case constant && math.Abs(scalar) < retimeTolerance:
+		return []gotio.Effect{gotio.NewFreezeFrame("", effectMetadata)}, sourceStart, metadata, nil
+	case constant:
+		warp := gotio.NewLinearTimeWarp("", "LinearTimeWarp", scalar, effectMetadata)
+		return []gotio.Effect{warp}, sourceStart, metadata, nil
+	}
+
+	timePoints := make([]interface{}, 0, len(timeMap.TimePoints))
+	for _, point := range timeMap.TimePoints {
+		timePoints = append(timePoints, map[string]interface{}{
+			"time":     point.Time,
+			"value":    point.Value,
+			"interp":   point.Interp,
+			"in_time":  point.InTime,
+			"out_time": point.OutTime,
+		})
+	}
+	metadata["fcpx_time_map"] = map[string]interface{}{
+		"frame_sampling":  timeMap.FrameSampling,
+		"preserves_pitch": timeMap.PreservesPitch,
+		"points":          timePoints,
+	}
+
+	return nil, sourceStart, metadata, nil
+}
+
+// timeMapScalar returns the speed of a time map and whether that speed is
+// constant, i.e. all of its points lie on one line. A single point is a hold.
+func timeMapScalar(times, values []float64) (float64, bool) {
+	n := len(times)
+	if n < 2 || times[n-1] == times[0] {
+		return 0, true
+	}
+
+	scalar := (values[n-1] - values[0]) / (times[n-1] - times[0])
+	for i := 1; i < n-1; i++ {
+		expected := values[0] + (times[i]-times[0])*scalar
+		if math.Abs(expected-values[i]) > retimeTolerance {
+			return scalar, false
+		}
+	}
+
+	return scalar, true
+}
+
+// mapTime maps clip time t to source time by interpolating linearly between
+// the points of a time map. Times outside the map extend its end segments.
+func mapTime(times, values []Time, t Time) Time {
+	n := len(times)
+	if n == 1 {
+		return values[0]
+	}
+
+	i := 1
+	for i < n-1 && t.Cmp(times[i]) > 0 {
+		i++
+	}
+	if times[i].Cmp(times[i-1]) == 0 {
+		return values[i]
+	}
+	return values[i-1].Add(t.Sub(times[i-1]).scale(values[i].Sub(values[i-1]), times[i].Sub(times[i-1])))
+}
+
+// convertRefClip converts a FCPX RefClip (compound clip) to OTIO Stack.
+func (d *Decoder) convertRefClip(refClip *RefClip, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	// Parse duration
+	duration, err := d.parseRationalTime(refClip.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse ref-clip duration: %w", err)
+	}
+
+	// Expand the referenced media's sequence onto tracks of its own
+	inner, err := d.expandMedia(refClip.Ref)
+	if err != nil {
+		return err
+	}
+
+	// Parse start time. It is in the media sequence's time, which begins at
+	// the sequence's start timecode.
+	start := inner.origin
+	if refClip.Start != "" {
+		start, err = d.parseRationalTime(refClip.Start)
+		if err != nil {
+			return fmt.Errorf("failed to parse ref-clip start: %w", err)
+		}
+	}
+
+	// Create source range
+	effects, sourceStart, metadata, err := d.convertRetiming(refClip.TimeMap, refClip.ConformRate, start)
+	if err != nil {
+		return err
+	}
+	effects = append(effects, d.convertFilterEffects(refClip.FilterVideos, refClip.FilterAudios)...)
+	sourceRange := opentime.NewTimeRange(subTime(sourceStart, inner.origin), duration)
+
+	// Convert markers
+	markers, err := d.convertMarkers(refClip.Markers, refClip.ChapterMarkers, refClip.Keywords, refClip.Ratings)
+	if err != nil {
+		return err
+	}
+
+	// Create a Stack to represent the compound clip
+	// In Python adapter, ref-clips become nested Stacks
+	stack := gotio.NewStack(refClip.Name, &sourceRange, nil, effects, markers, nil)
+
+	// Add metadata for compound clip reference
+	metadata["fcpx_ref"] = refClip.Ref
+	if refClip.SrcEnable != "" {
+		metadata["fcpx_src_enable"] = refClip.SrcEnable
+	}
+	if refClip.VideoRole != "" {
+		metadata["fcpx_video_role"] = refClip.VideoRole
+	}
+	if fcpx := convertNotes(refClip.Note, refClip.Metadata); fcpx != nil {
+		metadata["fcpx"] = fcpx
+	}
+	stack.SetMetadata(metadata)
+
+	// srcEnable limits the compound clip to its video or audio
+	videoTracks, audioTracks := inner.videoTracks(), inner.audioTracks()
+	switch refClip.SrcEnable {
+	case "video":
+		audioTracks = nil
+	case "audio":
+		videoTracks = nil
+	}
+	for _, track := range videoTracks {
+		stack.AppendChild(track)
+	}
+	for _, track := range audioTracks {
+		stack.AppendChild(track)
+	}
+
+	// Compound clips used only for their audio belong with the audio tracks
+	if refClip.SrcEnable == "audio" || (len(videoTracks) == 0 && len(audioTracks) > 0) {
+		tracks.place(tracks.audioTrack(lane), stack, offset, duration)
+	} else {
+		tracks.place(tracks.videoTrack(lane), stack, offset, duration)
+	}
+
+	return nil
+}
+
+// expandMedia converts the sequence of the media resource with the given id
+// onto tracks of its own. Refs that don't resolve to a media sequence yield
+// empty tracks. Media that contains itself, or that is nested deeper than
+// the MaxCompoundDepth option allows, fails the decode.
+func (d *Decoder) expandMedia(ref string) (*laneTracks, error) {
+	tracks := newLaneTracks()
+	media, ok := d.media[ref]
+	if !ok || media.Sequence == nil || media.Sequence.Spine == nil {
+		return tracks, nil
+	}
+
+	for _, id := range d.expanding {
+		if id == ref {
+			return nil, fmt.Errorf("compound clip %q contains itself", media.Name)
+		}
+	}
+	maxDepth := d.opts.MaxCompoundDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxCompoundDepth
+	}
+	if len(d.expanding) >= maxDepth {
+		return nil, fmt.Errorf("compound clip %q is nested more than %d deep", media.Name, maxDepth)
+	}
+
+	if media.Sequence.TCStart != "" {
+		origin, err := d.parseRationalTime(media.Sequence.TCStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse media tcStart: %w", err)
+		}
+		tracks.origin = origin
+	}
+
+	d.expanding = append(d.expanding, ref)
+	defer func() { d.expanding = d.expanding[:len(d.expanding)-1] }()
+
+	if _, err := d.convertSpine(media.Sequence.Spine, tracks); err != nil {
+		return nil, err
+	}
+	if err := d.arrangeTracks(tracks); err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
+// convertMCClip converts a FCPX MCClip (multicam clip use) to OTIO clips cut
+// from its active video and audio angles. The multicam's angles and the ones
+// in use are recorded in "fcpx_multicam" metadata.
+func (d *Decoder) convertMCClip(mcClip *MCClip, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	duration, err := d.parseRationalTime(mcClip.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse mc-clip duration: %w", err)
+	}
+
+	multicam := &Multicam{}
+	if media, ok := d.media[mcClip.Ref]; ok && media.Multicam != nil {
+		multicam = media.Multicam
+	}
+
+	// Multicam time begins at the multicam's start timecode
+	origin := opentime.NewRationalTime(0, 1)
+	if multicam.TCStart != "" {
+		origin, err = d.parseRationalTime(multicam.TCStart)
+		if err != nil {
+			return fmt.Errorf("failed to parse multicam tcStart: %w", err)
+		}
+	}
+	start := origin
+	if mcClip.Start != "" {
+		start, err = d.parseRationalTime(mcClip.Start)
+		if err != nil {
+			return fmt.Errorf("failed to parse mc-clip start: %w", err)
+		}
+	}
+
+	// Convert markers
+	markers, err := d.convertMarkers(mcClip.Markers, mcClip.ChapterMarkers, mcClip.Keywords, mcClip.Ratings)
+	if err != nil {
+		return err
+	}
+
+	// Sources pick the angles used for video and audio. Without any, the
+	// first angle is used for both.
+	var videoAngle, audioAngle string
+	if len(mcClip.Sources) == 0 && len(multicam.Angles) > 0 {
+		videoAngle, audioAngle = multicam.Angles[0].AngleID, multicam.Angles[0].AngleID
+	}
+	for _, source := range mcClip.Sources {
+		switch source.SrcEnable {
+		case "", "all":
+			videoAngle, audioAngle = source.AngleID, source.AngleID
+		case "video":
+			videoAngle = source.AngleID
+		case "audio":
+			audioAngle = source.AngleID
+		}
+	}
+
+	angles := make([]interface{}, 0, len(multicam.Angles))
+	for _, angle := range multicam.Angles {
+		angles = append(angles, map[string]interface{}{
+			"name":     angle.Name,
+			"angle_id": angle.AngleID,
+		})
+	}
+
+	// Create a clip from each active angle
+	for _, use := range []struct {
+		angleID string
+		video   bool
+	}{{videoAngle, true}, {audioAngle, false}} {
+		if use.angleID == "" {
+			continue
+		}
+
+		effects, mappedStart, metadata, err := d.convertRetiming(mcClip.TimeMap, mcClip.ConformRate, start)
+		if err != nil {
+			return err
+		}
+		ref, sourceStart, err := d.convertAngle(multicam, use.angleID, origin, mappedStart, duration, use.video)
+		if err != nil {
+			return err
+		}
+
+		if use.video {
+			effects = append(effects, d.convertFilterEffects(mcClip.FilterVideos, nil)...)
+		} else {
+			effects = append(effects, d.convertFilterEffects(nil, mcClip.FilterAudios)...)
+		}
+
+		metadata["fcpx_multicam"] = map[string]interface{}{
+			"ref":            mcClip.Ref,
+			"angle_id":       use.angleID,
+			"video_angle_id": videoAngle,
+			"audio_angle_id": audioAngle,
+			"angles":         angles,
+			"source_offset":  TimeFromRationalTime(subTime(mappedStart, sourceStart)).String(),
+		}
+		if fcpx := convertNotes(mcClip.Note, mcClip.Metadata); fcpx != nil {
+			metadata["fcpx"] = fcpx
+		}
+
+		sourceRange := opentime.NewTimeRange(sourceStart, duration)
+		otioClip := gotio.NewClip(mcClip.Name, ref, &sourceRange, metadata, effects, markers, "", nil)
+		if use.video {
+			tracks.place(tracks.videoTrack(lane), otioClip, offset, duration)
+		} else {
+			tracks.place(tracks.audioTrack(lane), otioClip, offset, duration)
+		}
+	}
+
+	return nil
+}
+
+// convertAngle finds the media playing at multicam time start on an angle
+// of a multicam clip. It returns the media's reference and the source time
+// corresponding to start. Angles without media at start yield an empty
+// reference.
+func (d *Decoder) convertAngle(multicam *Multicam, angleID string, origin, start, duration opentime.RationalTime, video bool) (*gotio.ExternalReference, opentime.RationalTime, error) {
+	empty := gotio.NewExternalReference("", "", nil, nil)
+
+	var angle *MCAngle
+	for _, a := range multicam.Angles {
+		if a.AngleID == angleID {
+			angle = a
+		}
+	}
+	if angle == nil {
+		return empty, start, nil
+	}
+
+	// Angles play their items one after another from the multicam's start
+	inner := newLaneTracks()
+	inner.origin = origin
+	if _, err := d.convertSpine(&Spine{Items: angle.Items}, inner); err != nil {
+		return nil, start, err
+	}
+	if err := d.arrangeTracks(inner); err != nil {
+		return nil, start, err
+	}
+
+	track := inner.audio[0]
+	if video {
+		track = inner.video[0]
+	}
+	for _, p := range inner.placements {
+		if p.track != track {
+			continue
+		}
+		end := addTime(p.offset, p.duration)
+		if subTime(start, p.offset).ToSeconds() < -timeTolerance || subTime(end, start).ToSeconds() <= timeTolerance {
+			continue
+		}
+
+		clip, ok := p.item.(*gotio.Clip)
+		if !ok {
+			break
+		}
+		if subTime(addTime(start, duration), end).ToSeconds() > timeTolerance {
+			d.warnings = append(d.warnings, fmt.Sprintf(
+				"multicam clip runs past the end of %q on angle %q", clip.Name(), angle.Name))
+		}
+
+		ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+		if !ok {
+			break
+		}
+		sourceStart := addTime(clip.SourceRange().StartTime(), subTime(start, p.offset))
+		return ref, sourceStart, nil
+	}
+
+	return empty, start, nil
+}
+
+// convertSyncClip converts a FCPX SyncClip to its video clip and synced audio
+// clips. The sync-clip's items are laid out in its own time, so they are
+// converted onto tracks of their own, trimmed to the sync-clip's range and
+// placed on the lanes relative to the sync-clip's. Transitions between them
+// are dropped with a warning, as is audio muted by the sync-clip's sync
+// sources, and captions go to the caption tracks of their roles. Each other
+// clip records the sync-clip in "fcpx_sync_clip" metadata.
+func (d *Decoder) convertSyncClip(syncClip *SyncClip, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	duration, err := d.parseRationalTime(syncClip.Duration)
+	if err != nil {
+		return fmt.Errorf("failed to parse sync-clip duration: %w", err)
+	}
+
+	start := opentime.NewRationalTime(0, 1)
+	if syncClip.Start != "" {
+		start, err = d.parseRationalTime(syncClip.Start)
+		if err != nil {
+			return fmt.Errorf("failed to parse sync-clip start: %w", err)
+		}
+	}
+
+	// Convert the content and the connected items in the sync-clip's time
+	inner := newLaneTracks()
+	inner.origin = start
+	for _, item := range syncClip.Items {
+		// Transitions within a sync-clip have no OTIO counterpart
+		if transition, ok := item.(*Transition); ok {
+			d.warnings = append(d.warnings, fmt.Sprintf("dropped transition %q inside sync-clip %q",
+				transition.Name, syncClip.Name))
+			continue
+		}
+		attrs := storyAttributes(item)
+		if attrs.lane != "" {
+			continue
+		}
+		itemOffset := start
+		if attrs.offset != "" {
+			itemOffset, err = d.parseRationalTime(attrs.offset)
+			if err != nil {
+				return fmt.Errorf("failed to parse sync-clip item offset: %w", err)
+			}
+		}
+		if err := d.convertStoryElement(item, itemOffset, 0, inner); err != nil {
+			return err
+		}
+	}
+	if err := d.convertConnected(syncClip, start, 0, inner); err != nil {
+		return err
+	}
+
+	// A sync source whose audio roles are all inactive mutes its audio
+	sources := make([]interface{}, 0, len(syncClip.SyncSources))
+	muted := make(map[string]bool)
+	for _, source := range syncClip.SyncSources {
+		roles := make([]interface{}, 0, len(source.AudioRoleSources))
+		active := len(source.AudioRoleSources) == 0
+		for _, role := range source.AudioRoleSources {
+			roles = append(roles, map[string]interface{}{
+				"role":   role.Role,
+				"active": role.Active,
+			})
+			if role.Active != "0" {
+				active = true
+			}
+		}
+		muted[source.SourceID] = !active
+		sources = append(sources, map[string]interface{}{
+			"source_id":          source.SourceID,
+			"audio_role_sources": roles,
+		})
+	}
+
+	lanes := make(map[*gotio.Track]int)
+	for l, track := range inner.video {
+		lanes[track] = l
+	}
+	for l, track := range inner.audio {
+		lanes[track] = l
+	}
+	captions := make(map[*gotio.Track]string)
+	for role, track := range inner.captions {
+		captions[track] = role
+	}
+
+	d.syncClips++
+	id := strconv.Itoa(d.syncClips)
+	end := addTime(start, duration)
+	for _, p := range inner.placements {
+		innerLane := lanes[p.track]
+		video := inner.video[innerLane] == p.track
+		role, caption := captions[p.track]
+		if !video && !caption {
+			source := "connected"
+			if innerLane == 0 {
+				source = "storyline"
+			}
+			if muted[source] {
+				continue
+			}
+		}
+
+		// Trim the item to the sync-clip's range
+		itemStart, itemEnd := p.offset, addTime(p.offset, p.duration)
+		if subTime(start, itemStart).ToSeconds() > 0 {
+			itemStart = start
+		}
+		if subTime(itemEnd, end).ToSeconds() > 0 {
+			itemEnd = end
+		}
+		length := subTime(itemEnd, itemStart)
+		if length.ToSeconds() <= timeTolerance {
+			continue
+		}
+
+		item := p.item
+		if clip, ok := item.(*gotio.Clip); ok {
+			var sourceStart opentime.RationalTime
+			if clip.SourceRange() != nil {
+				sourceStart = clip.SourceRange().StartTime()
+			}
+			sourceRange := opentime.NewTimeRange(addTime(sourceStart, subTime(itemStart, p.offset)), length)
+
+			metadata := clip.Metadata()
+			if metadata == nil {
+				metadata = make(map[string]interface{})
+			}
+			// Captions keep to their caption tracks, outside the sync-clip
+			if !caption {
+				sync := map[string]interface{}{
+					"id":           id,
+					"name":         syncClip.Name,
+					"lane":         strconv.Itoa(innerLane),
+					"offset":       TimeFromRationalTime(subTime(itemStart, start)).String(),
+					"sync_sources": sources,
+				}
+				// The sync-clip's own note and metadata are kept apart from
+				// those of the clips it holds
+				if fcpx := convertNotes(syncClip.Note, syncClip.Metadata); fcpx != nil {
+					sync["fcpx"] = fcpx
+				}
+				metadata["fcpx_sync_clip"] = sync
+			}
+			item = gotio.NewClip(clip.Name(), clip.MediaReference(), &sourceRange, metadata, clip.Effects(), clip.Markers(), "", nil)
+		}
+
+		recordOffset := addTime(offset, subTime(itemStart, start))
+		if caption {
+			tracks.place(tracks.captionTrack(role), item, recordOffset, length)
+		} else if video {
+			tracks.place(tracks.videoTrack(lane+innerLane), item, recordOffset, length)
+		} else {
+			tracks.place(tracks.audioTrack(lane+innerLane), item, recordOffset, length)
+		}
+	}
+
+	return nil
+}
+
+// convertAudition converts the pick of a FCPX Audition chosen by the
+// AuditionPick option. Every clip of the audition is listed in the
+// "fcpx_audition" metadata of the items converted from the pick.
+func (d *Decoder) convertAudition(audition *Audition, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	if len(audition.Items) == 0 {
+		return nil
+	}
+
+	pick := 0
+	if d.opts.AuditionPick > 0 && d.opts.AuditionPick < len(audition.Items) {
+		pick = d.opts.AuditionPick
+	}
+
+	clips := make([]interface{}, 0, len(audition.Items))
+	for _, item := range audition.Items {
+		clips = append(clips, describeStoryElement(item))
+	}
+
+	// The pick plays at the audition's offset, for as long as the active
+	// clip, so alternates longer than it are trimmed
+	item := audition.Items[pick]
+	if pick > 0 {
+		duration, err := d.parseRationalTime(storyAttributes(audition).duration)
+		if err != nil {
+			return fmt.Errorf("failed to parse audition duration: %w", err)
+		}
+		pickDuration, err := d.parseRationalTime(storyAttributes(item).duration)
+		if err != nil {
+			return fmt.Errorf("failed to parse audition pick duration: %w", err)
+		}
+		if pickDuration.ToSeconds()-duration.ToSeconds() > timeTolerance {
+			item = trimStoryElement(item, storyAttributes(audition).duration)
+		}
+	}
+	inner := newLaneTracks()
+	if err := d.convertStoryElement(item, offset, 0, inner); err != nil {
+		return err
+	}
+
+	lanes := make(map[*gotio.Track]int)
+	for l, track := range inner.video {
+		lanes[track] = l
+	}
+	for l, track := range inner.audio {
+		lanes[track] = l
+	}
+	captions := make(map[*gotio.Track]string)
+	for role, track := range inner.captions {
+		captions[track] = role
+	}
+
+	for _, p := range inner.placements {
+		if metadata := p.item.Metadata(); metadata != nil {
+			metadata["fcpx_audition"] = map[string]interface{}{
+				"pick":  pick,
+				"clips": clips,
+			}
+		}
+
+		innerLane := lanes[p.track]
+		if role, ok := captions[p.track]; ok {
+			tracks.place(tracks.captionTrack(role), p.item, p.offset, p.duration)
+		} else if inner.video[innerLane] == p.track {
+			tracks.place(tracks.videoTrack(lane+innerLane), p.item, p.offset, p.duration)
+		} else {
+			tracks.place(tracks.audioTrack(lane+innerLane), p.item, p.offset, p.duration)
+		}
+	}
+
+	return nil
+}
+
+// trimStoryElement returns a copy of a clip-like story element with the
+// given duration. Other elements are returned unchanged.
+func trimStoryElement(item interface{}, duration string) interface{} {
+	switch v := item.(type) {
+	case *Clip:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *Video:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *Audio:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *Title:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *RefClip:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *MCClip:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	case *SyncClip:
+		trimmed := *v
+		trimmed.Duration = duration
+		return &trimmed
+	}
+	return item
+}
+
+// describeStoryElement summarises a story element for metadata.
+func describeStoryElement(item interface{}) map[string]interface{} {
+	attrs := storyAttributes(item)
+	description := map[string]interface{}{
+		"start":    attrs.start,
+		"duration": attrs.duration,
+	}
+
+	switch v := item.(type) {
+	case *Clip:
+		description["element"] = v.XMLName.Local
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *Video:
+		description["element"] = "video"
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *Audio:
+		description["element"] = "audio"
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *RefClip:
+		description["element"] = "ref-clip"
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *MCClip:
+		description["element"] = "mc-clip"
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *SyncClip:
+		description["element"] = "sync-clip"
+		description["name"] = v.Name
+	case *Title:
+		description["element"] = "title"
+		description["name"] = v.Name
+		description["ref"] = v.Ref
+	case *Caption:
+		description["element"] = "caption"
+		description["name"] = v.Name
+	}
+
+	return description
+}
+
+// convertStoryline converts a secondary storyline to an OTIO Stack holding
+// the storyline's own tracks, placed on the tracks for its lane.
+func (d *Decoder) convertStoryline(spine *Spine, offset opentime.RationalTime, lane int, tracks *laneTracks) error {
+	inner := newLaneTracks()
+	duration, err := d.convertSpine(spine, inner)
 	if err != nil {
-		return opentime.RationalTime{}, fmt.Errorf("invalid rational time numerator: %s", parts[0])
+		return err
+	}
+
+	metadata := map[string]interface{}{
+		"fcpx_storyline": true,
+		"fcpx_lane":      spine.Lane,
+	}
+	stack := gotio.NewStack(spine.Name, nil, metadata, nil, nil, nil)
+	if err := d.layoutTracks(inner, stack); err != nil {
+		return err
+	}
+
+	// Storylines holding only audio belong with the audio tracks
+	if len(inner.videoTracks()) > 0 || len(inner.captionTracks()) > 0 {
+		tracks.place(tracks.videoTrack(lane), stack, offset, duration)
+	} else {
+		tracks.place(tracks.audioTrack(lane), stack, offset, duration)
+	}
+
+	return nil
+}
+
+// storyInfo holds the attributes shared by story elements.
+type storyInfo struct {
+	lane, offset, start, duration string
+
+	// connected holds the story elements nested inside the element
+	connected []interface{}
+}
+
+// storyAttributes returns the attributes of a story element. A clip's video
+// or audio child that sits on a lane is treated as connected to the clip.
+func storyAttributes(item interface{}) storyInfo {
+	switch v := item.(type) {
+	case *Clip:
+		info := storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+		if v.Video != nil && v.Video.Lane != "" {
+			info.connected = append([]interface{}{v.Video}, info.connected...)
+		}
+		if v.Audio != nil && v.Audio.Lane != "" {
+			info.connected = append([]interface{}{v.Audio}, info.connected...)
+		}
+		return info
+	case *Video:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Audio:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Gap:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Title:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Caption:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Transition:
+		return storyInfo{offset: v.Offset, duration: v.Duration}
+	case *RefClip:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *MCClip:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *SyncClip:
+		return storyInfo{v.Lane, v.Offset, v.Start, v.Duration, v.Items}
+	case *Audition:
+		// An audition takes its timing from its active pick
+		info := storyInfo{lane: v.Lane, offset: v.Offset}
+		if len(v.Items) > 0 {
+			pick := storyAttributes(v.Items[0])
+			info.start, info.duration = pick.start, pick.duration
+		}
+		return info
+	case *Spine:
+		// A storyline's items are its content, not connected to it
+		return storyInfo{lane: v.Lane, offset: v.Offset}
+	}
+	return storyInfo{}
+}
+
+// placement is an item waiting to be laid out on a track.
+type placement struct {
+	track    *gotio.Track
+	item     gotio.Composable
+	offset   opentime.RationalTime
+	duration opentime.RationalTime
+}
+
+// laneTracks holds the OTIO tracks built for each FCPX lane of a storyline.
+// Items are collected first and laid out once conversion is done, since
+// connected items don't arrive in record order.
+type laneTracks struct {
+	video      map[int]*gotio.Track
+	audio      map[int]*gotio.Track
+	placements []placement
+
+	// captions holds a track per caption role, which captions use instead
+	// of their lanes.
+	captions map[string]*gotio.Track
+
+	// overflow holds the extra tracks taking connected items that overlap
+	// others on a lane or caption track, in the order they were added.
+	overflow map[*gotio.Track][]*gotio.Track
+
+	// origin is the record time at which the tracks start.
+	origin opentime.RationalTime
+}
+
+// newLaneTracks creates an empty set of lane tracks.
+func newLaneTracks() *laneTracks {
+	return &laneTracks{
+		video:    make(map[int]*gotio.Track),
+		audio:    make(map[int]*gotio.Track),
+		captions: make(map[string]*gotio.Track),
+		overflow: make(map[*gotio.Track][]*gotio.Track),
+		origin:   opentime.NewRationalTime(0, 1),
+	}
+}
+
+// videoTrack returns the video track for lane, creating it if needed.
+func (lt *laneTracks) videoTrack(lane int) *gotio.Track {
+	track, ok := lt.video[lane]
+	if !ok {
+		track = gotio.NewTrack(laneTrackName("Video", lane), nil, gotio.TrackKindVideo, nil, nil)
+		lt.video[lane] = track
+	}
+	return track
+}
+
+// audioTrack returns the audio track for lane, creating it if needed.
+func (lt *laneTracks) audioTrack(lane int) *gotio.Track {
+	track, ok := lt.audio[lane]
+	if !ok {
+		track = gotio.NewTrack(laneTrackName("Audio", lane), nil, gotio.TrackKindAudio, nil, nil)
+		lt.audio[lane] = track
+	}
+	return track
+}
+
+// captionTrack returns the caption track for role, creating it if needed.
+// It is named after the role's caption format and records the role in
+// "fcpx_caption_role" metadata.
+func (lt *laneTracks) captionTrack(role string) *gotio.Track {
+	track, ok := lt.captions[role]
+	if !ok {
+		name := "Captions"
+		if format := captionFormat(role); format != "" {
+			name += " " + format
+		} else if role != "" {
+			name += " " + role
+		}
+		metadata := map[string]interface{}{"fcpx_caption_role": role}
+		track = gotio.NewTrack(name, nil, gotio.TrackKindVideo, metadata, nil)
+		lt.captions[role] = track
+	}
+	return track
+}
+
+// primary reports whether track holds a lane 0 storyline, whose items may
+// not overlap.
+func (lt *laneTracks) primary(track *gotio.Track) bool {
+	return track == lt.video[0] || track == lt.audio[0]
+}
+
+// overflowTrack returns the first extra track for track whose items end by
+// offset, according to ends, adding one if there is none. Extra tracks are
+// numbered after the track they take items for.
+func (lt *laneTracks) overflowTrack(track *gotio.Track, offset opentime.RationalTime, ends map[*gotio.Track]opentime.RationalTime) *gotio.Track {
+	for _, extra := range lt.overflow[track] {
+		if subTime(offset, ends[extra]).ToSeconds() >= -timeTolerance {
+			return extra
+		}
+	}
+
+	name := fmt.Sprintf("%s (%d)", track.Name(), len(lt.overflow[track])+2)
+	metadata := make(map[string]interface{}, len(track.Metadata()))
+	for key, value := range track.Metadata() {
+		metadata[key] = value
+	}
+	extra := gotio.NewTrack(name, nil, track.Kind(), metadata, nil)
+	lt.overflow[track] = append(lt.overflow[track], extra)
+	return extra
+}
+
+// withOverflow returns tracks with the extra tracks of each following it.
+func (lt *laneTracks) withOverflow(tracks []*gotio.Track) []*gotio.Track {
+	var all []*gotio.Track
+	for _, track := range tracks {
+		all = append(all, track)
+		for _, extra := range lt.overflow[track] {
+			if len(extra.Children()) > 0 {
+				all = append(all, extra)
+			}
+		}
+	}
+	return all
+}
+
+// place queues item for layout on track at the record position offset.
+func (lt *laneTracks) place(track *gotio.Track, item gotio.Composable, offset, duration opentime.RationalTime) {
+	lt.placements = append(lt.placements, placement{track, item, offset, duration})
+}
+
+// videoTracks returns the video tracks that have children, lowest lane first.
+func (lt *laneTracks) videoTracks() []*gotio.Track {
+	var tracks []*gotio.Track
+	for _, lane := range sortedLanes(lt.video) {
+		if track := lt.video[lane]; len(track.Children()) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	return lt.withOverflow(tracks)
+}
+
+// audioTracks returns the audio tracks that have children, starting with
+// the lane nearest the spine.
+func (lt *laneTracks) audioTracks() []*gotio.Track {
+	var tracks []*gotio.Track
+	lanes := sortedLanes(lt.audio)
+	for i := len(lanes) - 1; i >= 0; i-- {
+		if track := lt.audio[lanes[i]]; len(track.Children()) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	return lt.withOverflow(tracks)
+}
+
+// captionTracks returns the caption tracks that have children, in role
+// order.
+func (lt *laneTracks) captionTracks() []*gotio.Track {
+	roles := make([]string, 0, len(lt.captions))
+	for role := range lt.captions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	var tracks []*gotio.Track
+	for _, role := range roles {
+		if track := lt.captions[role]; len(track.Children()) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+	return lt.withOverflow(tracks)
+}
+
+// laneTrackName names the track for a lane. Lanes on the usual side of the
+// spine for the kind (above for video, below for audio) are numbered on from
+// the spine's "Video 1" and "Audio 1"; others are named after their lane.
+func laneTrackName(kind string, lane int) string {
+	n := lane
+	if kind == "Audio" {
+		n = -lane
+	}
+	if n < 0 {
+		return fmt.Sprintf("%s Lane %d", kind, lane)
+	}
+	return fmt.Sprintf("%s %d", kind, n+1)
+}
+
+// layoutTracks lays the queued items out on their tracks and appends the
+// tracks that received items to stack. Video tracks are stacked from the
+// lowest lane up, followed by the caption tracks, then audio tracks from the
+// spine down.
+func (d *Decoder) layoutTracks(tracks *laneTracks, stack *gotio.Stack) error {
+	if err := d.arrangeTracks(tracks); err != nil {
+		return err
+	}
+
+	for _, track := range tracks.videoTracks() {
+		stack.AppendChild(track)
+	}
+	for _, track := range tracks.captionTracks() {
+		stack.AppendChild(track)
+	}
+	for _, track := range tracks.audioTracks() {
+		stack.AppendChild(track)
+	}
+
+	return nil
+}
+
+// arrangeTracks appends the queued items to their tracks in record order.
+// Holes are filled with gaps. Connected items of different parents may share
+// a lane and overlap, so an item starting before the end of its connected
+// lane goes to an extra track for the lane; on the primary storyline it
+// overlaps the item before it.
+func (d *Decoder) arrangeTracks(tracks *laneTracks) error {
+	sort.SliceStable(tracks.placements, func(i, j int) bool {
+		return tracks.placements[i].offset.ToSeconds() < tracks.placements[j].offset.ToSeconds()
+	})
+
+	ends := make(map[*gotio.Track]opentime.RationalTime)
+	for _, p := range tracks.placements {
+		offset := p.offset
+		end, ok := ends[p.track]
+		if !ok {
+			end = tracks.origin
+		}
+		hole := subTime(offset, end)
+		if hole.ToSeconds() < -timeTolerance && !tracks.primary(p.track) {
+			p.track = tracks.overflowTrack(p.track, offset, ends)
+			end, ok = ends[p.track]
+			if !ok {
+				end = tracks.origin
+			}
+			hole = subTime(offset, end)
+		}
+
+		switch {
+		case hole.ToSeconds() > timeTolerance:
+			gapRange := opentime.NewTimeRange(opentime.NewRationalTime(0, hole.Rate()), hole)
+			p.track.AppendChild(gotio.NewGap("", &gapRange, nil, nil, nil, nil))
+		case hole.ToSeconds() < -timeTolerance:
+			msg := fmt.Sprintf("item at %gs overlaps the previous item on track %q by %gs",
+				offset.ToSeconds(), p.track.Name(), -hole.ToSeconds())
+			if !d.opts.AllowOverlaps {
+				return errors.New(msg)
+			}
+			d.warnings = append(d.warnings, msg)
+			offset = end
+		}
+
+		p.track.AppendChild(p.item)
+		ends[p.track] = addTime(offset, p.duration)
+	}
+
+	return nil
+}
+
+// roleTrack is a track holding the items of one role, and the record time
+// at which its last item ends.
+type roleTrack struct {
+	key   string
+	track *gotio.Track
+	end   opentime.RationalTime
+}
+
+// groupByRole moves the video or audio items queued on lane tracks onto a
+// track per role or subrole, named after it. Items keep to the role track
+// of the item before them on their lane where they fit, so transitions stay
+// between the items they join; transitions whose items went to different
+// tracks are dropped. Gaps are dropped, since layout fills holes anyway.
+func (d *Decoder) groupByRole(tracks *laneTracks, grouping TrackGrouping, video bool) {
+	lanes, roleKind, kind, step := tracks.audio, "fcpx_audio_role", gotio.TrackKindAudio, -1
+	if video {
+		lanes, roleKind, kind, step = tracks.video, "fcpx_video_role", gotio.TrackKindVideo, 1
+	}
+
+	laneTracks := make(map[*gotio.Track]bool)
+	for _, track := range lanes {
+		laneTracks[track] = true
+	}
+
+	sort.SliceStable(tracks.placements, func(i, j int) bool {
+		return tracks.placements[i].offset.ToSeconds() < tracks.placements[j].offset.ToSeconds()
+	})
+
+	groups := make(map[string][]*roleTrack)
+	last := make(map[*gotio.Track]*roleTrack)
+	fits := func(rt *roleTrack, offset opentime.RationalTime) bool {
+		return subTime(offset, rt.end).ToSeconds() >= -timeTolerance
 	}
 
-	// Parse denominator (rate)
-	rate, err := strconv.ParseFloat(parts[1], 64)
+	placements := make([]placement, 0, len(tracks.placements))
+	for _, p := range tracks.placements {
+		if !laneTracks[p.track] {
+			placements = append(placements, p)
+			continue
+		}
+
+		var rt *roleTrack
+		switch p.item.(type) {
+		case *gotio.Gap:
+			continue
+		case *gotio.Transition:
+			prev := last[p.track]
+			if prev == nil || math.Abs(subTime(p.offset, prev.end).ToSeconds()) > timeTolerance {
+				d.warnings = append(d.warnings, fmt.Sprintf("dropped transition at %gs joining items of different roles",
+					p.offset.ToSeconds()))
+				continue
+			}
+			rt = prev
+		default:
+			key := roleKey(itemRole(p.item, video), grouping)
+			if prev := last[p.track]; prev != nil && prev.key == key && fits(prev, p.offset) {
+				rt = prev
+			} else {
+				for _, candidate := range groups[key] {
+					if fits(candidate, p.offset) {
+						rt = candidate
+						break
+					}
+				}
+			}
+			if rt == nil {
+				name := roleTrackName(key)
+				if n := len(groups[key]); n > 0 {
+					name = fmt.Sprintf("%s %d", name, n+1)
+				}
+				metadata := map[string]interface{}{roleKind: key}
+				rt = &roleTrack{key: key, track: gotio.NewTrack(name, nil, kind, metadata, nil)}
+				groups[key] = append(groups[key], rt)
+			}
+			rt.end = addTime(p.offset, p.duration)
+		}
+
+		last[p.track] = rt
+		p.track = rt.track
+		placements = append(placements, p)
+	}
+	tracks.placements = placements
+
+	// Role tracks replace the lane tracks, standard roles nearest the spine
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := roleRank(keys[i]), roleRank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	roleTracks := make(map[int]*gotio.Track)
+	lane := 0
+	for _, key := range keys {
+		for _, rt := range groups[key] {
+			roleTracks[lane] = rt.track
+			lane += step
+		}
+	}
+	if video {
+		tracks.video = roleTracks
+	} else {
+		tracks.audio = roleTracks
+	}
+}
+
+// itemRole returns the video or audio role recorded on an item, or for
+// compound clips and storylines the role of the first item inside with one.
+// Items without a role take Final Cut Pro's defaults of video and dialogue.
+func itemRole(item gotio.Composable, video bool) string {
+	key, fallback := "fcpx_audio_role", "dialogue"
+	if video {
+		key, fallback = "fcpx_video_role", "video"
+	}
+	if role := recordedRole(item, key); role != "" {
+		return role
+	}
+	return fallback
+}
+
+// recordedRole returns the role recorded under key on item or the first item
+// inside it with one, or "" if there is none.
+func recordedRole(item gotio.Composable, key string) string {
+	if role, ok := item.Metadata()[key].(string); ok && role != "" {
+		return role
+	}
+	if composition, ok := item.(interface{ Children() []gotio.Composable }); ok {
+		for _, child := range composition.Children() {
+			if role := recordedRole(child, key); role != "" {
+				return role
+			}
+		}
+	}
+	return ""
+}
+
+// roleKey returns the role or subrole an item with the given role is
+// grouped by. A role without a subrole is in its default subrole, as in
+// "dialogue.dialogue-1".
+func roleKey(role string, grouping TrackGrouping) string {
+	main, sub, ok := strings.Cut(role, ".")
+	if grouping == GroupByRole {
+		return main
+	}
+	if !ok {
+		sub = main + "-1"
+	}
+	return main + "." + sub
+}
+
+// roleTrackName names the track for a role or subrole key after the role,
+// or the subrole when there is one.
+func roleTrackName(key string) string {
+	name := key
+	if _, sub, ok := strings.Cut(key, "."); ok {
+		name = sub
+	}
+	if name == "" {
+		return name
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// roleRank orders Final Cut Pro's standard roles before custom ones.
+func roleRank(key string) int {
+	main, _, _ := strings.Cut(key, ".")
+	switch main {
+	case "dialogue", "video":
+		return 0
+	case "music", "titles":
+		return 1
+	case "effects":
+		return 2
+	}
+	return 3
+}
+
+// sortedLanes returns the lanes of m in ascending order.
+func sortedLanes(m map[int]*gotio.Track) []int {
+	lanes := make([]int, 0, len(m))
+	for lane := range m {
+		lanes = append(lanes, lane)
+	}
+	sort.Ints(lanes)
+	return lanes
+}
+
+// addTime returns a+b. A zero time without a rate takes the other's rate.
+func addTime(a, b opentime.RationalTime) opentime.RationalTime {
+	if a.Rate() == 0 {
+		return b
+	}
+	if b.Rate() == 0 {
+		return a
+	}
+	return a.Add(b)
+}
+
+// subTime returns a-b. A zero time without a rate takes the other's rate.
+func subTime(a, b opentime.RationalTime) opentime.RationalTime {
+	if b.Rate() == 0 {
+		return a
+	}
+	if a.Rate() == 0 {
+		return opentime.NewRationalTime(-b.Value(), b.Rate())
+	}
+	return a.Sub(b)
+}
+
+// parseRationalTime parses an FCPX time string, a rational number of
+// seconds, into an OTIO RationalTime at the sequence's frame rate. Without a
+// sequence format, times keep their own timebase.
+func (d *Decoder) parseRationalTime(s string) (opentime.RationalTime, error) {
+	if s == "" {
+		return opentime.RationalTime{}, nil
+	}
+
+	t, err := ParseTime(s)
 	if err != nil {
-		return opentime.RationalTime{}, fmt.Errorf("invalid rational time denominator: %s", parts[1])
+		return opentime.RationalTime{}, err
+	}
+	return d.rationalTime(t), nil
+}
+
+// parseOptionalTime parses an FCPX time string, where an empty string is
+// zero.
+func parseOptionalTime(s string) (Time, error) {
+	if s == "" {
+		return Time{}, nil
 	}
+	return ParseTime(s)
+}
 
-	// FCPX uses value/rate where value is in the rate's time base
-	// Convert to OTIO format (value in frames, rate in fps)
-	// The FCPX format is: frames/timebase, where timebase is the rate
-	return opentime.NewRationalTime(value, rate), nil
+// rationalTime converts t to an OTIO RationalTime in frames of the
+// sequence's frame duration, or in t's own timebase when it has none.
+func (d *Decoder) rationalTime(t Time) opentime.RationalTime {
+	if d.frameDuration.IsZero() {
+		return t.RationalTime()
+	}
+	return t.RationalTimeIn(d.frameDuration)
 }
@@ -4,9 +4,12 @@
 package fcpxml
 
 import (
+	"bytes"
+	"os"
 	"strings"
 	"testing"
 
+	"github.com/Avalanche-io/gotio"
 	"github.com/Avalanche-io/gotio/opentime"
 )
 
@@ -101,23 +104,40 @@ func TestDecoder_WithMarkers(t *testing.T) {
 }
 
 func TestDecoder_ParseRationalTime(t *testing.T) {
-	decoder := &Decoder{}
+	ntsc := 30000.0 / 1001
 
 	tests := []struct {
-		input    string
-		expected opentime.RationalTime
-		wantErr  bool
+		input         string
+		frameDuration string
+		expected      opentime.RationalTime
+		wantErr       bool
 	}{
-		{"1200/24s", opentime.NewRationalTime(1200, 24), false},
-		{"0/24s", opentime.NewRationalTime(0, 24), false},
-		{"3600/30s", opentime.NewRationalTime(3600, 30), false},
-		{"1001/30000s", opentime.NewRationalTime(1001, 30000), false},
-		{"", opentime.RationalTime{}, false},
-		{"invalid", opentime.RationalTime{}, true},
+		// Without a sequence format, times keep their own timebase
+		{"1200/24s", "", opentime.NewRationalTime(1200, 24), false},
+		{"0/24s", "", opentime.NewRationalTime(0, 24), false},
+		{"3600/30s", "", opentime.NewRationalTime(3600, 30), false},
+		{"1001/30000s", "", opentime.NewRationalTime(1001, 30000), false},
+		{"10s", "", opentime.NewRationalTime(10, 1), false},
+		// With one, they are seconds counted in frames of the sequence
+		{"10s", "1/24s", opentime.NewRationalTime(240, 24), false},
+		{"80s", "100/3000s", opentime.NewRationalTime(2400, 30), false},
+		{"10900/3000s", "100/3000s", opentime.NewRationalTime(109, 30), false},
+		{"1001/30000s", "1001/30000s", opentime.NewRationalTime(1, ntsc), false},
+		{"", "", opentime.RationalTime{}, false},
+		{"invalid", "", opentime.RationalTime{}, true},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
+		t.Run(tt.input+" at "+tt.frameDuration, func(t *testing.T) {
+			decoder := &Decoder{}
+			if tt.frameDuration != "" {
+				frameDuration, err := ParseTime(tt.frameDuration)
+				if err != nil {
+					t.Fatalf("ParseTime(%q) failed: %v", tt.frameDuration, err)
+				}
+				decoder.frameDuration = frameDuration
+			}
+
 			result, err := decoder.parseRationalTime(tt.input)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseRationalTime(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
@@ -132,6 +152,40 @@ func TestDecoder_ParseRationalTime(t *testing.T) {
 	}
 }
 
+func TestDecoder_SequenceFrameRate(t *testing.T) {
+	data, err := os.ReadFile("testdata/fcpx_example.fcpxml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// The sequence's format is 1080p30, and "80s" is 80 seconds long
+	for _, clip := range timeline.FindClips(nil, false) {
+		if clip.SourceRange() == nil {
+			continue
+		}
+		if rate := clip.SourceRange().Duration().Rate(); rate != 30 {
+			t.Errorf("Expected clip '%s' at 30 fps, got %g", clip.Name(), rate)
+		}
+	}
+	var stack *gotio.Stack
+	for _, child := range timeline.VideoTracks()[0].Children() {
+		if s, ok := child.(*gotio.Stack); ok && stack == nil {
+			stack = s
+		}
+	}
+	if stack == nil {
+		t.Fatal("Expected a compound clip on the video track")
+	}
+	if duration := stack.SourceRange().Duration().ToSeconds(); duration != 30 {
+		t.Errorf("Expected compound clip duration 30s, got %gs", duration)
+	}
+}
+
 func TestDecoder_LibraryStructure(t *testing.T) {
 	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
 <fcpxml version="1.9">
@@ -196,3 +250,1725 @@ func TestDecoder_EmptyProject(t *testing.T) {
 		t.Errorf("Expected 0 children in empty project, got %d", totalChildren)
 	}
 }
+
+func TestDecoder_AssetReferences(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="A001" uid="ABC123" src="file:///media/A001.mov" start="0/24s" duration="2400/24s" hasVideo="1" hasAudio="1" audioChannels="2" audioRate="48000"/>
+	</resources>
+	<project name="Asset Test">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Shot 1" ref="r2" duration="1200/24s" start="240/24s"/>
+				<clip name="Shot 2" duration="600/24s">
+					<video ref="r2" duration="600/24s"/>
+				</clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 {
+		t.Fatalf("Expected 1 video track, got %d", len(videoTracks))
+	}
+	if len(timeline.AudioTracks()) != 1 {
+		t.Errorf("Expected 1 audio track, got %d", len(timeline.AudioTracks()))
+	}
+
+	children := videoTracks[0].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 children in video track, got %d", len(children))
+	}
+
+	for _, child := range children {
+		clip, ok := child.(*gotio.Clip)
+		if !ok {
+			t.Fatalf("Expected *gotio.Clip, got %T", child)
+		}
+		ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+		if !ok {
+			t.Fatalf("Expected *gotio.ExternalReference, got %T", clip.MediaReference())
+		}
+		if ref.TargetURL() != "file:///media/A001.mov" {
+			t.Errorf("Expected target URL 'file:///media/A001.mov', got '%s'", ref.TargetURL())
+		}
+		if ref.AvailableRange() == nil {
+			t.Fatalf("Expected available range to be set on %s", clip.Name())
+		}
+		if !ref.AvailableRange().Duration().StrictlyEqual(opentime.NewRationalTime(2400, 24)) {
+			t.Errorf("Expected available duration 2400/24, got %v", ref.AvailableRange().Duration())
+		}
+		if ref.Metadata()["fcpx_asset_id"] != "r2" {
+			t.Errorf("Expected fcpx_asset_id 'r2', got %v", ref.Metadata()["fcpx_asset_id"])
+		}
+	}
+}
+
+func TestDecoder_AssetWithoutEssenceFlags(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="A001" src="file:///media/A001.mov" start="0s" duration="100s"/>
+		<asset id="r3" name="A002" src="file:///media/A002.mov" start="0s" duration="100s" hasVideo="1"/>
+	</resources>
+	<project name="Asset Test">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Shot 1" ref="r2" offset="0s" duration="5s" audioRole="dialogue" audioDuration="5s"/>
+				<asset-clip name="Shot 2" ref="r3" offset="5s" duration="5s" audioDuration="5s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	timeline, err := NewDecoder(strings.NewReader(fcpxmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// Without hasVideo and hasAudio, the essence is inferred from the
+	// asset-clip; an asset that says it has no audio keeps it from Shot 2
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 || len(videoTracks[0].Children()) != 2 {
+		t.Fatalf("Expected both clips on a video track, got %v", videoTracks)
+	}
+	audioTracks := timeline.AudioTracks()
+	if len(audioTracks) != 1 {
+		t.Fatalf("Expected 1 audio track, got %d", len(audioTracks))
+	}
+	children := audioTracks[0].Children()
+	if len(children) != 1 {
+		t.Fatalf("Expected only Shot 1's audio, got %d items", len(children))
+	}
+	if clip, ok := children[0].(*gotio.Clip); !ok || clip.Name() != "Shot 1" {
+		t.Errorf("Expected Shot 1's audio, got %v", children[0])
+	}
+}
+
+func TestDecoder_SpineOffsets(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Offset Test">
+		<sequence format="r1">
+			<spine>
+				<video name="Clip 2" offset="1800/24s" duration="600/24s"/>
+				<video name="Clip 1" offset="0/24s" duration="1200/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 1 {
+		t.Fatalf("Expected 1 video track, got %d", len(videoTracks))
+	}
+
+	// Clip 1, a gap filling the hole, then Clip 2
+	children := videoTracks[0].Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 children in video track, got %d", len(children))
+	}
+	if clip, ok := children[0].(*gotio.Clip); !ok || clip.Name() != "Clip 1" {
+		t.Errorf("Expected first child to be 'Clip 1', got %T", children[0])
+	}
+	gap, ok := children[1].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected second child to be a gap, got %T", children[1])
+	}
+	duration, err := gap.Duration()
+	if err != nil {
+		t.Fatalf("Failed to get gap duration: %v", err)
+	}
+	if duration.ToSeconds() != 25 {
+		t.Errorf("Expected gap of 25s, got %gs", duration.ToSeconds())
+	}
+	if clip, ok := children[2].(*gotio.Clip); !ok || clip.Name() != "Clip 2" {
+		t.Errorf("Expected third child to be 'Clip 2', got %T", children[2])
+	}
+}
+
+func TestDecoder_SpineOverlap(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Overlap Test">
+		<sequence format="r1">
+			<spine>
+				<video name="Clip 1" offset="0/24s" duration="1200/24s"/>
+				<video name="Clip 2" offset="600/24s" duration="1200/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	if _, err := decoder.Decode(); err == nil {
+		t.Fatal("Expected an error for overlapping spine items")
+	}
+
+	decoder = NewDecoder(strings.NewReader(fcpxmlData))
+	decoder.SetOptions(DecoderOptions{AllowOverlaps: true})
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML with overlaps allowed: %v", err)
+	}
+	if len(decoder.Warnings()) != 1 {
+		t.Errorf("Expected 1 warning, got %d", len(decoder.Warnings()))
+	}
+	if children := timeline.VideoTracks()[0].Children(); len(children) != 2 {
+		t.Errorf("Expected 2 children in video track, got %d", len(children))
+	}
+}
+
+func TestDecoder_ConnectedClips(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Lane Test">
+		<sequence format="r1">
+			<spine>
+				<video name="A-Roll" offset="0/24s" duration="240/24s">
+					<audio name="Sound FX" lane="-1" offset="48/24s" duration="48/24s"/>
+				</video>
+				<gap name="Gap" offset="240/24s" start="86400/24s" duration="240/24s">
+					<video name="B-Roll" lane="1" offset="86424/24s" duration="120/24s"/>
+				</gap>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+	if videoTracks[1].Name() != "Video 2" {
+		t.Errorf("Expected lane 1 track named 'Video 2', got '%s'", videoTracks[1].Name())
+	}
+
+	// B-Roll starts 1s into the gap at 10s
+	children := videoTracks[1].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 children in lane 1 track, got %d", len(children))
+	}
+	gap, ok := children[0].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected lane 1 track to start with a gap, got %T", children[0])
+	}
+	if duration, _ := gap.Duration(); duration.ToSeconds() != 11 {
+		t.Errorf("Expected B-Roll to start at 11s, got %gs", duration.ToSeconds())
+	}
+
+	// Sound FX starts 2s into A-Roll on the first lane below the spine
+	var sfx *gotio.Track
+	for _, track := range timeline.AudioTracks() {
+		if track.Name() == "Audio 2" {
+			sfx = track
+		}
+	}
+	if sfx == nil {
+		t.Fatal("Expected an 'Audio 2' track for lane -1")
+	}
+	children = sfx.Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 children in lane -1 track, got %d", len(children))
+	}
+	if clip, ok := children[1].(*gotio.Clip); !ok || clip.Name() != "Sound FX" {
+		t.Errorf("Expected 'Sound FX' clip on lane -1 track, got %T", children[1])
+	}
+}
+
+func TestDecoder_OverlappingConnectedClips(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Lane Overlap Test">
+		<sequence format="r1">
+			<spine>
+				<video name="A-Roll" offset="0s" start="0s" duration="5s">
+					<video name="B-Roll 1" lane="1" offset="3s" duration="4s"/>
+				</video>
+				<video name="A-Roll 2" offset="5s" start="10s" duration="5s">
+					<video name="B-Roll 2" lane="1" offset="11s" duration="2s"/>
+				</video>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	// Connected clips of different parents may overlap on a lane, so the
+	// later one goes to a track of its own
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+	if len(decoder.Warnings()) != 0 {
+		t.Errorf("Expected no warnings, got %v", decoder.Warnings())
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 3 {
+		t.Fatalf("Expected 3 video tracks, got %d", len(videoTracks))
+	}
+	if videoTracks[1].Name() != "Video 2" || videoTracks[2].Name() != "Video 2 (2)" {
+		t.Errorf("Expected 'Video 2' and 'Video 2 (2)', got '%s' and '%s'", videoTracks[1].Name(), videoTracks[2].Name())
+	}
+	for i, want := range []struct {
+		name string
+		gap  float64
+	}{{"B-Roll 1", 3}, {"B-Roll 2", 6}} {
+		children := videoTracks[i+1].Children()
+		if len(children) != 2 {
+			t.Fatalf("Expected a gap and %s, got %d items", want.name, len(children))
+		}
+		gap, ok := children[0].(*gotio.Gap)
+		if !ok {
+			t.Fatalf("Expected a gap before %s, got %T", want.name, children[0])
+		}
+		if d, _ := gap.Duration(); d.ToSeconds() != want.gap {
+			t.Errorf("Expected a %gs gap before %s, got %gs", want.gap, want.name, d.ToSeconds())
+		}
+		if clip, ok := children[1].(*gotio.Clip); !ok || clip.Name() != want.name {
+			t.Errorf("Expected %s, got %v", want.name, children[1])
+		}
+	}
+}
+
+func TestDecoder_SecondaryStoryline(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Storyline Test">
+		<sequence format="r1">
+			<spine>
+				<gap name="Gap" offset="0/24s" start="86400/24s" duration="480/24s">
+					<spine lane="1" offset="86448/24s">
+						<video name="Alt 1" offset="0/24s" duration="96/24s"/>
+						<gap name="Pause" offset="96/24s" duration="24/24s"/>
+						<video name="Alt 2" offset="120/24s" duration="96/24s"/>
+					</spine>
+				</gap>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+
+	// The storyline starts 2s into the gap
+	children := videoTracks[1].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 children in lane 1 track, got %d", len(children))
+	}
+	if gap, ok := children[0].(*gotio.Gap); !ok {
+		t.Errorf("Expected lane 1 track to start with a gap, got %T", children[0])
+	} else if duration, _ := gap.Duration(); duration.ToSeconds() != 2 {
+		t.Errorf("Expected storyline to start at 2s, got %gs", duration.ToSeconds())
+	}
+
+	stack, ok := children[1].(*gotio.Stack)
+	if !ok {
+		t.Fatalf("Expected storyline to be a *gotio.Stack, got %T", children[1])
+	}
+	if stack.Metadata()["fcpx_storyline"] != true {
+		t.Errorf("Expected fcpx_storyline metadata on storyline stack")
+	}
+
+	var storylineVideo *gotio.Track
+	for _, child := range stack.Children() {
+		if track, ok := child.(*gotio.Track); ok && track.Kind() == gotio.TrackKindVideo {
+			storylineVideo = track
+		}
+	}
+	if storylineVideo == nil {
+		t.Fatal("Expected a video track inside the storyline stack")
+	}
+	if len(storylineVideo.Children()) != 3 {
+		t.Errorf("Expected 3 children in storyline video track, got %d", len(storylineVideo.Children()))
+	}
+}
+
+func TestDecoder_Retiming(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Retime Test">
+		<sequence format="r1">
+			<spine>
+				<video name="Fast" offset="0/24s" start="24/24s" duration="48/24s">
+					<timeMap preservesPitch="0">
+						<timept time="0/24s" value="0/24s" interp="linear"/>
+						<timept time="96/24s" value="192/24s" interp="linear"/>
+					</timeMap>
+				</video>
+				<video name="Hold" offset="48/24s" duration="48/24s">
+					<conform-rate scaleEnabled="0" srcFrameRate="25"/>
+					<timeMap>
+						<timept time="0/24s" value="24/24s" interp="linear"/>
+						<timept time="48/24s" value="24/24s" interp="linear"/>
+					</timeMap>
+				</video>
+				<video name="Ramp" offset="96/24s" duration="48/24s">
+					<timeMap>
+						<timept time="0/24s" value="0/24s" interp="smooth2"/>
+						<timept time="24/24s" value="12/24s" interp="smooth2"/>
+						<timept time="48/24s" value="72/24s" interp="smooth2"/>
+					</timeMap>
+				</video>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 clips, got %d", len(children))
+	}
+
+	// Constant speed becomes a LinearTimeWarp, with the source range
+	// starting at the mapped start time
+	fast := children[0].(*gotio.Clip)
+	if len(fast.Effects()) != 1 {
+		t.Fatalf("Expected 1 effect on 'Fast', got %d", len(fast.Effects()))
+	}
+	warp, ok := fast.Effects()[0].(*gotio.LinearTimeWarp)
+	if !ok {
+		t.Fatalf("Expected a LinearTimeWarp, got %T", fast.Effects()[0])
+	}
+	if warp.TimeScalar() != 2 {
+		t.Errorf("Expected time scalar 2, got %g", warp.TimeScalar())
+	}
+	if start := fast.SourceRange().StartTime().ToSeconds(); start != 2 {
+		t.Errorf("Expected source start 2s, got %gs", start)
+	}
+
+	// A hold becomes a FreezeFrame
+	hold := children[1].(*gotio.Clip)
+	if len(hold.Effects()) != 1 {
+		t.Fatalf("Expected 1 effect on 'Hold', got %d", len(hold.Effects()))
+	}
+	if _, ok := hold.Effects()[0].(*gotio.FreezeFrame); !ok {
+		t.Errorf("Expected a FreezeFrame, got %T", hold.Effects()[0])
+	}
+	if _, ok := hold.Metadata()["fcpx_conform_rate"]; !ok {
+		t.Error("Expected conform-rate to be kept in metadata")
+	}
+
+	// A variable ramp is kept in metadata
+	ramp := children[2].(*gotio.Clip)
+	if len(ramp.Effects()) != 0 {
+		t.Errorf("Expected no effects on 'Ramp', got %d", len(ramp.Effects()))
+	}
+	timeMap, ok := ramp.Metadata()["fcpx_time_map"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx_time_map metadata on 'Ramp'")
+	}
+	if points, _ := timeMap["points"].([]interface{}); len(points) != 3 {
+		t.Errorf("Expected 3 time points, got %d", len(points))
+	}
+}
+
+func TestDecoder_CompoundClipExpansion(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<media id="r1" name="Compound">
+			<sequence format="r2" tcStart="240/24s">
+				<spine>
+					<video name="Inner" offset="240/24s" duration="96/24s">
+						<audio name="Inner Audio" lane="-1" offset="0/24s" duration="96/24s"/>
+					</video>
+				</spine>
+			</sequence>
+		</media>
+	</resources>
+	<project name="Compound Test">
+		<sequence format="r2">
+			<spine>
+				<ref-clip name="Compound" ref="r1" offset="0/24s" start="264/24s" duration="48/24s"/>
+				<ref-clip name="Compound Audio" ref="r1" srcEnable="audio" offset="48/24s" duration="48/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// The compound clip holds the media's video and audio tracks, and its
+	// source range is relative to the media sequence's start
+	videoChildren := timeline.VideoTracks()[0].Children()
+	if len(videoChildren) != 1 {
+		t.Fatalf("Expected 1 item on the video track, got %d", len(videoChildren))
+	}
+	stack, ok := videoChildren[0].(*gotio.Stack)
+	if !ok {
+		t.Fatalf("Expected a Stack, got %T", videoChildren[0])
+	}
+	if len(stack.Children()) != 2 {
+		t.Fatalf("Expected 2 tracks in compound clip, got %d", len(stack.Children()))
+	}
+	inner := stack.Children()[0].(*gotio.Track).Children()
+	if clip, ok := inner[0].(*gotio.Clip); !ok || clip.Name() != "Inner" {
+		t.Errorf("Expected compound clip to start with 'Inner', got %T", inner[0])
+	}
+	if start := stack.SourceRange().StartTime().ToSeconds(); start != 1 {
+		t.Errorf("Expected compound clip source start 1s, got %gs", start)
+	}
+
+	// srcEnable="audio" keeps only the audio and places it with the audio
+	var audioStack *gotio.Stack
+	for _, track := range timeline.AudioTracks() {
+		for _, child := range track.Children() {
+			if s, ok := child.(*gotio.Stack); ok {
+				audioStack = s
+			}
+		}
+	}
+	if audioStack == nil {
+		t.Fatal("Expected the audio-only compound clip on an audio track")
+	}
+	if len(audioStack.Children()) != 1 {
+		t.Fatalf("Expected 1 track in audio-only compound clip, got %d", len(audioStack.Children()))
+	}
+	if kind := audioStack.Children()[0].(*gotio.Track).Kind(); kind != gotio.TrackKindAudio {
+		t.Errorf("Expected an audio track, got %s", kind)
+	}
+}
+
+func TestDecoder_CompoundClipLimits(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<media id="r1" name="Outer">
+			<sequence format="r3">
+				<spine>
+					<ref-clip name="Inner" ref="r2" duration="24/24s"/>
+				</spine>
+			</sequence>
+		</media>
+		<media id="r2" name="Inner">
+			<sequence format="r3">
+				<spine>
+					<ref-clip name="Outer" ref="r1" duration="24/24s"/>
+				</spine>
+			</sequence>
+		</media>
+	</resources>
+	<project name="Cycle Test">
+		<sequence format="r3">
+			<spine>
+				<ref-clip name="Outer" ref="r1" duration="24/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	if _, err := decoder.Decode(); err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("Expected a compound clip cycle error, got %v", err)
+	}
+
+	decoder = NewDecoder(strings.NewReader(fcpxmlData))
+	decoder.SetOptions(DecoderOptions{MaxCompoundDepth: 1})
+	if _, err := decoder.Decode(); err == nil || !strings.Contains(err.Error(), "nested more than 1 deep") {
+		t.Errorf("Expected a compound clip depth error, got %v", err)
+	}
+}
+
+// multicamFCPXML holds a two angle multicam clip, used with the video of the
+// first angle and the audio of the second.
+const multicamFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Cam A" src="file:///media/CamA.mov" start="0/24s" duration="2400/24s" hasVideo="1" hasAudio="1"/>
+		<asset id="r3" name="Cam B" src="file:///media/CamB.mov" start="0/24s" duration="2400/24s" hasVideo="1" hasAudio="1"/>
+		<media id="r4" name="Interview">
+			<multicam format="r1" tcStart="0/24s">
+				<mc-angle name="Wide" angleID="A1">
+					<asset-clip name="Cam A" ref="r2" offset="0/24s" duration="480/24s"/>
+				</mc-angle>
+				<mc-angle name="Close" angleID="B1">
+					<gap name="Gap" offset="0/24s" duration="24/24s"/>
+					<asset-clip name="Cam B" ref="r3" offset="24/24s" start="240/24s" duration="480/24s"/>
+				</mc-angle>
+			</multicam>
+		</media>
+	</resources>
+	<project name="Multicam Test">
+		<sequence format="r1">
+			<spine>
+				<mc-clip name="Interview" ref="r4" offset="0/24s" start="48/24s" duration="96/24s">
+					<mc-source angleID="A1" srcEnable="video"/>
+					<mc-source angleID="B1" srcEnable="audio"/>
+				</mc-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_Multicam(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(multicamFCPXML))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// The video comes from the wide angle, 2s into Cam A
+	videoChildren := timeline.VideoTracks()[0].Children()
+	if len(videoChildren) != 1 {
+		t.Fatalf("Expected 1 video clip, got %d", len(videoChildren))
+	}
+	video := videoChildren[0].(*gotio.Clip)
+	ref, ok := video.MediaReference().(*gotio.ExternalReference)
+	if !ok || ref.TargetURL() != "file:///media/CamA.mov" {
+		t.Errorf("Expected video from Cam A, got %v", video.MediaReference())
+	}
+	if start := video.SourceRange().StartTime().ToSeconds(); start != 2 {
+		t.Errorf("Expected video source start 2s, got %gs", start)
+	}
+
+	// The audio comes from the close angle, which starts 1s in at 10s
+	audioChildren := timeline.AudioTracks()[0].Children()
+	if len(audioChildren) != 1 {
+		t.Fatalf("Expected 1 audio clip, got %d", len(audioChildren))
+	}
+	audio := audioChildren[0].(*gotio.Clip)
+	ref, ok = audio.MediaReference().(*gotio.ExternalReference)
+	if !ok || ref.TargetURL() != "file:///media/CamB.mov" {
+		t.Errorf("Expected audio from Cam B, got %v", audio.MediaReference())
+	}
+	if start := audio.SourceRange().StartTime().ToSeconds(); start != 11 {
+		t.Errorf("Expected audio source start 11s, got %gs", start)
+	}
+
+	multicam, ok := video.Metadata()["fcpx_multicam"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx_multicam metadata")
+	}
+	if angles, _ := multicam["angles"].([]interface{}); len(angles) != 2 {
+		t.Errorf("Expected 2 angles in metadata, got %d", len(angles))
+	}
+	if multicam["audio_angle_id"] != "B1" {
+		t.Errorf("Expected audio angle B1, got %v", multicam["audio_angle_id"])
+	}
+}
+
+// syncClipFCPXML holds a camera clip synced with a separate recording, with
+// the camera's own audio turned off.
+const syncClipFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Camera" src="file:///media/Camera.mov" start="0/24s" duration="2400/24s" hasVideo="1" hasAudio="1"/>
+		<asset id="r3" name="Recorder" src="file:///media/Recorder.wav" start="0/24s" duration="2400/24s" hasAudio="1"/>
+	</resources>
+	<project name="Sync Test">
+		<sequence format="r1">
+			<spine>
+				<sync-clip name="Take 1" offset="0/24s" start="24/24s" duration="96/24s">
+					<asset-clip name="Camera" ref="r2" offset="0/24s" duration="240/24s">
+						<asset-clip name="Recorder" ref="r3" lane="-1" offset="0/24s" start="480/24s" duration="240/24s"/>
+					</asset-clip>
+					<sync-source sourceID="storyline">
+						<audio-role-source role="dialogue.dialogue-1" active="0"/>
+					</sync-source>
+				</sync-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_SyncClip(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(syncClipFCPXML))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// The camera video is trimmed to the sync-clip's range
+	videoChildren := timeline.VideoTracks()[0].Children()
+	if len(videoChildren) != 1 {
+		t.Fatalf("Expected 1 video clip, got %d", len(videoChildren))
+	}
+	video := videoChildren[0].(*gotio.Clip)
+	if start := video.SourceRange().StartTime().ToSeconds(); start != 1 {
+		t.Errorf("Expected video source start 1s, got %gs", start)
+	}
+	if duration := video.SourceRange().Duration().ToSeconds(); duration != 4 {
+		t.Errorf("Expected video duration 4s, got %gs", duration)
+	}
+	if _, ok := video.Metadata()["fcpx_sync_clip"]; !ok {
+		t.Error("Expected fcpx_sync_clip metadata on the video clip")
+	}
+
+	// The camera audio is muted, leaving the recorder on the lane below
+	audioTracks := timeline.AudioTracks()
+	if len(audioTracks) != 1 {
+		t.Fatalf("Expected 1 audio track, got %d", len(audioTracks))
+	}
+	if audioTracks[0].Name() != "Audio 2" {
+		t.Errorf("Expected the recorder on 'Audio 2', got '%s'", audioTracks[0].Name())
+	}
+	audio := audioTracks[0].Children()[0].(*gotio.Clip)
+	if audio.Name() != "Recorder" {
+		t.Errorf("Expected 'Recorder' clip, got '%s'", audio.Name())
+	}
+	if start := audio.SourceRange().StartTime().ToSeconds(); start != 21 {
+		t.Errorf("Expected recorder source start 21s, got %gs", start)
+	}
+}
+
+func TestDecoder_SyncClipTransition(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Camera" src="file:///media/Camera.mov" start="0s" duration="100s" hasVideo="1"/>
+	</resources>
+	<project name="Sync Transition">
+		<sequence format="r1">
+			<spine>
+				<sync-clip name="Take 1" offset="0s" duration="4s">
+					<asset-clip name="Camera A" ref="r2" offset="0s" duration="2s"/>
+					<transition name="Cross Dissolve" offset="1s" duration="2s"/>
+					<asset-clip name="Camera B" ref="r2" offset="2s" start="10s" duration="2s"/>
+				</sync-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	decoder := NewDecoder(strings.NewReader(fcpxmlData))
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected the 2 clips without the transition, got %d items", len(children))
+	}
+	warnings := decoder.Warnings()
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Cross Dissolve") {
+		t.Errorf("Expected a warning for the dropped transition, got %v", warnings)
+	}
+}
+
+func TestDecoder_Audition(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Audition Test">
+		<sequence format="r1">
+			<spine>
+				<audition offset="0/24s">
+					<video name="Take 1" duration="48/24s"/>
+					<video name="Take 2" start="24/24s" duration="72/24s"/>
+				</audition>
+				<video name="After" offset="48/24s" duration="48/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	tests := []struct {
+		pick int
+		want string
+	}{
+		{0, "Take 1"},
+		{1, "Take 2"},
+		{5, "Take 1"},
+	}
+	for _, tt := range tests {
+		decoder := NewDecoder(strings.NewReader(fcpxmlData))
+		decoder.SetOptions(DecoderOptions{AuditionPick: tt.pick, AllowOverlaps: true})
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Failed to decode FCPX XML: %v", err)
+		}
+
+		children := timeline.VideoTracks()[0].Children()
+		if len(children) != 2 {
+			t.Fatalf("Expected 2 clips with pick %d, got %d", tt.pick, len(children))
+		}
+		clip := children[0].(*gotio.Clip)
+		if clip.Name() != tt.want {
+			t.Errorf("Expected pick %d to decode '%s', got '%s'", tt.pick, tt.want, clip.Name())
+		}
+
+		audition, ok := clip.Metadata()["fcpx_audition"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected fcpx_audition metadata with pick %d", tt.pick)
+		}
+		if clips, _ := audition["clips"].([]interface{}); len(clips) != 2 {
+			t.Errorf("Expected 2 audition clips in metadata, got %d", len(clips))
+		}
+	}
+}
+
+func TestDecoder_AuditionPickLength(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Audition Test">
+		<sequence format="r1">
+			<spine>
+				<audition offset="0/24s">
+					<video name="Take 1" duration="48/24s"/>
+					<video name="Take 2" start="24/24s" duration="120/24s"/>
+					<video name="Take 3" duration="24/24s"/>
+				</audition>
+				<video name="After" offset="48/24s" duration="48/24s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	// Longer alternates are trimmed to the audition, shorter ones leave a gap
+	tests := []struct {
+		pick     int
+		duration float64
+		items    int
+	}{
+		{1, 2, 2},
+		{2, 1, 3},
+	}
+	for _, tt := range tests {
+		decoder := NewDecoder(strings.NewReader(fcpxmlData))
+		decoder.SetOptions(DecoderOptions{AuditionPick: tt.pick})
+		timeline, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Failed to decode FCPX XML with pick %d: %v", tt.pick, err)
+		}
+
+		children := timeline.VideoTracks()[0].Children()
+		if len(children) != tt.items {
+			t.Fatalf("Expected %d items with pick %d, got %d", tt.items, tt.pick, len(children))
+		}
+		clip := children[0].(*gotio.Clip)
+		if d, _ := clip.Duration(); d.ToSeconds() != tt.duration {
+			t.Errorf("Expected pick %d to last %gs, got %gs", tt.pick, tt.duration, d.ToSeconds())
+		}
+		if start := clip.SourceRange().StartTime().ToSeconds(); tt.pick == 1 && start != 1 {
+			t.Errorf("Expected the trimmed pick to keep its source start, got %gs", start)
+		}
+		if after := children[len(children)-1].(*gotio.Clip); after.Name() != "After" {
+			t.Errorf("Expected 'After' to follow the audition, got '%s'", after.Name())
+		}
+	}
+}
+
+// ntscSequenceFCPXML holds a drop-frame 29.97 sequence starting at one hour.
+const ntscSequenceFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" name="FFVideoFormat1080p2997" frameDuration="1001/30000s" width="1920" height="1080" colorSpace="1-1-1 (Rec. 709)"/>
+	</resources>
+	<project name="NTSC Test">
+		<sequence format="r1" tcStart="3600s" tcFormat="DF" audioLayout="stereo" audioRate="48k">
+			<spine>
+				<video name="Shot 1" offset="3600s" duration="30030/30000s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_SequenceSettings(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(ntscSequenceFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	start := timeline.GlobalStartTime()
+	if start == nil {
+		t.Fatal("Expected a global start time")
+	}
+	if start.ToSeconds() != 3600 {
+		t.Errorf("Expected global start time 3600s, got %gs", start.ToSeconds())
+	}
+	if start.Rate() != 30000.0/1001 {
+		t.Errorf("Expected global start time at 29.97 fps, got %g", start.Rate())
+	}
+
+	metadata := timeline.Metadata()
+	if metadata["fcpx_drop_frame"] != true {
+		t.Errorf("Expected drop-frame timecode, got %v", metadata["fcpx_drop_frame"])
+	}
+	format, ok := metadata["fcpx_format"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx_format metadata")
+	}
+	if format["width"] != "1920" || format["height"] != "1080" || format["color_space"] != "1-1-1 (Rec. 709)" {
+		t.Errorf("Expected 1920x1080 Rec. 709 format, got %v", format)
+	}
+
+	// The spine starts at the start timecode, so there is no leading gap
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 1 {
+		t.Fatalf("Expected 1 clip, got %d", len(children))
+	}
+	if _, ok := children[0].(*gotio.Clip); !ok {
+		t.Errorf("Expected the spine to start with a clip, got %T", children[0])
+	}
+}
+
+// markerKindsFCPXML holds a clip with a standard marker, an incomplete and a
+// completed to-do marker, and a chapter marker.
+const markerKindsFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="Marker Kinds">
+		<sequence format="r1">
+			<spine>
+				<video name="Review" duration="240/24s" start="0s">
+					<marker start="24/24s" duration="1/24s" value="Standard"/>
+					<marker start="48/24s" duration="1/24s" value="Fix color" note="Too warm" completed="0"/>
+					<marker start="72/24s" duration="1/24s" value="Fix audio" completed="1"/>
+					<chapter-marker start="96/24s" duration="1/24s" value="Act Two" posterOffset="12/24s"/>
+				</video>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_MarkerKinds(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(markerKindsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	clips := timeline.FindClips(nil, false)
+	if len(clips) != 1 {
+		t.Fatalf("Expected 1 clip, got %d", len(clips))
+	}
+	markers := clips[0].Markers()
+	if len(markers) != 4 {
+		t.Fatalf("Expected 4 markers, got %d", len(markers))
+	}
+
+	tests := []struct {
+		name  string
+		color string
+		kind  string
+	}{
+		{"Standard", gotio.MarkerColorPurple, "standard"},
+		{"Fix color", gotio.MarkerColorRed, "todo"},
+		{"Fix audio", gotio.MarkerColorGreen, "todo"},
+		{"Act Two", gotio.MarkerColorOrange, "chapter"},
+	}
+	for i, tt := range tests {
+		marker := markers[i]
+		if marker.Name() != tt.name {
+			t.Errorf("Marker %d: expected name %q, got %q", i, tt.name, marker.Name())
+		}
+		if marker.Color() != tt.color {
+			t.Errorf("Marker %q: expected color %v, got %v", tt.name, tt.color, marker.Color())
+		}
+		if kind := marker.Metadata()["fcpx_marker_kind"]; kind != tt.kind {
+			t.Errorf("Marker %q: expected kind %q, got %v", tt.name, tt.kind, kind)
+		}
+	}
+
+	if offset := markers[3].Metadata()["fcpx_poster_offset"]; offset != "12/24s" {
+		t.Errorf("Expected chapter poster offset 12/24s, got %v", offset)
+	}
+}
+
+// keywordsFCPXML holds an asset-clip logged with keyword ranges and ratings.
+const keywordsFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="IMG_0857" start="0s" duration="100s" hasVideo="1" format="r1" src="file:///media/IMG_0857.mov"/>
+	</resources>
+	<project name="Selects">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="IMG_0857" ref="r2" offset="0s" start="10s" duration="20s">
+					<keyword start="10s" duration="20s" value="snow, truck"/>
+					<keyword start="15s" duration="5s" value="tree" note="wide"/>
+					<rating name="Best take" start="12s" duration="4s" value="favorite"/>
+					<rating start="25s" duration="2s" value="reject"/>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_KeywordsAndRatings(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(keywordsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	clips := timeline.FindClips(nil, false)
+	if len(clips) != 1 {
+		t.Fatalf("Expected 1 clip, got %d", len(clips))
+	}
+	markers := clips[0].Markers()
+	if len(markers) != 4 {
+		t.Fatalf("Expected 4 markers, got %d", len(markers))
+	}
+
+	tests := []struct {
+		name     string
+		color    string
+		kind     string
+		start    float64
+		duration float64
+	}{
+		{"snow, truck", gotio.MarkerColorBlue, "keyword", 10, 20},
+		{"tree", gotio.MarkerColorBlue, "keyword", 15, 5},
+		{"Best take", gotio.MarkerColorYellow, "rating", 12, 4},
+		{"reject", gotio.MarkerColorBlack, "rating", 25, 2},
+	}
+	for i, tt := range tests {
+		marker := markers[i]
+		if marker.Name() != tt.name {
+			t.Errorf("Marker %d: expected name %q, got %q", i, tt.name, marker.Name())
+		}
+		if marker.Color() != tt.color {
+			t.Errorf("Marker %q: expected color %v, got %v", tt.name, tt.color, marker.Color())
+		}
+		if kind := marker.Metadata()["fcpx_marker_kind"]; kind != tt.kind {
+			t.Errorf("Marker %q: expected kind %q, got %v", tt.name, tt.kind, kind)
+		}
+		markedRange := marker.MarkedRange()
+		if markedRange.StartTime().ToSeconds() != tt.start || markedRange.Duration().ToSeconds() != tt.duration {
+			t.Errorf("Marker %q: expected range %gs+%gs, got %gs+%gs", tt.name, tt.start, tt.duration,
+				markedRange.StartTime().ToSeconds(), markedRange.Duration().ToSeconds())
+		}
+	}
+
+	if markers[1].Comment() != "wide" {
+		t.Errorf("Expected keyword note 'wide', got %q", markers[1].Comment())
+	}
+	if rating := markers[2].Metadata()["fcpx_rating"]; rating != "favorite" {
+		t.Errorf("Expected favorite rating, got %v", rating)
+	}
+}
+
+// notesFCPXML holds notes and metadata on an asset, an asset-clip and the
+// project's sequence, including an array-valued md entry.
+const notesFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="IMG_0857" start="0s" duration="100s" hasVideo="1" format="r1">
+			<media-rep kind="original-media" src="file:///media/IMG_0857.mov"/>
+			<metadata>
+				<md key="com.apple.proapps.spotlight.kMDItemCodecs">
+					<array>
+						<string>AAC</string>
+						<string>H.264</string>
+					</array>
+				</md>
+			</metadata>
+		</asset>
+	</resources>
+	<project name="Notes">
+		<sequence format="r1">
+			<note>Picture lock v2</note>
+			<spine>
+				<asset-clip name="IMG_0857" ref="r2" offset="0s" duration="10s">
+					<note>Truck in snow</note>
+					<metadata>
+						<md key="com.apple.proapps.studio.scene" value="17"/>
+						<md key="com.apple.proapps.studio.shot" value="3"/>
+					</metadata>
+				</asset-clip>
+			</spine>
+			<metadata>
+				<md key="com.apple.proapps.studio.reel" value="5"/>
+			</metadata>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_NotesAndMetadata(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(notesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	fcpx, ok := timeline.Metadata()["fcpx"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx metadata on the timeline")
+	}
+	if fcpx["note"] != "Picture lock v2" {
+		t.Errorf("Expected the sequence note, got %v", fcpx["note"])
+	}
+	if md, _ := fcpx["metadata"].(map[string]interface{}); md["com.apple.proapps.studio.reel"] != "5" {
+		t.Errorf("Expected the sequence reel metadata, got %v", fcpx["metadata"])
+	}
+
+	clips := timeline.FindClips(nil, false)
+	if len(clips) != 1 {
+		t.Fatalf("Expected 1 clip, got %d", len(clips))
+	}
+	fcpx, ok = clips[0].Metadata()["fcpx"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx metadata on the clip")
+	}
+	if fcpx["note"] != "Truck in snow" {
+		t.Errorf("Expected the clip note, got %v", fcpx["note"])
+	}
+	md, _ := fcpx["metadata"].(map[string]interface{})
+	if md["com.apple.proapps.studio.scene"] != "17" || md["com.apple.proapps.studio.shot"] != "3" {
+		t.Errorf("Expected scene and shot metadata, got %v", md)
+	}
+
+	fcpx, ok = clips[0].MediaReference().Metadata()["fcpx"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx metadata on the media reference")
+	}
+	md, _ = fcpx["metadata"].(map[string]interface{})
+	codecs, _ := md["com.apple.proapps.spotlight.kMDItemCodecs"].([]interface{})
+	if len(codecs) != 2 || codecs[0] != "AAC" || codecs[1] != "H.264" {
+		t.Errorf("Expected the codecs array, got %v", md["com.apple.proapps.spotlight.kMDItemCodecs"])
+	}
+}
+
+// clipNotesFCPXML holds notes and metadata on a ref-clip, an mc-clip and a
+// sync-clip.
+const clipNotesFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Camera" src="file:///media/Camera.mov" start="0s" duration="100s" hasVideo="1"/>
+		<media id="r3" name="Compound">
+			<sequence format="r1">
+				<spine>
+					<asset-clip name="Camera" ref="r2" offset="0s" duration="10s"/>
+				</spine>
+			</sequence>
+		</media>
+		<media id="r4" name="Interview">
+			<multicam format="r1">
+				<mc-angle name="Wide" angleID="A1">
+					<asset-clip name="Camera" ref="r2" offset="0s" duration="10s"/>
+				</mc-angle>
+			</multicam>
+		</media>
+	</resources>
+	<project name="Clip Notes">
+		<sequence format="r1">
+			<spine>
+				<ref-clip name="Compound" ref="r3" offset="0s" duration="2s">
+					<note>Compound note</note>
+					<metadata>
+						<md key="com.apple.proapps.studio.scene" value="1"/>
+					</metadata>
+				</ref-clip>
+				<mc-clip name="Interview" ref="r4" offset="2s" duration="2s">
+					<note>Multicam note</note>
+					<mc-source angleID="A1" srcEnable="video"/>
+					<metadata>
+						<md key="com.apple.proapps.studio.scene" value="2"/>
+					</metadata>
+				</mc-clip>
+				<sync-clip name="Take 1" offset="4s" duration="2s">
+					<note>Sync note</note>
+					<asset-clip name="Camera" ref="r2" offset="0s" duration="2s"/>
+					<metadata>
+						<md key="com.apple.proapps.studio.scene" value="3"/>
+					</metadata>
+				</sync-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_ClipNotesAndMetadata(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(clipNotesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	children := timeline.VideoTracks()[0].Children()
+	if len(children) != 3 {
+		t.Fatalf("Expected 3 video items, got %d", len(children))
+	}
+	sync, _ := children[2].Metadata()["fcpx_sync_clip"].(map[string]interface{})
+	for i, metadata := range []map[string]interface{}{children[0].Metadata(), children[1].Metadata(), sync} {
+		fcpx, ok := metadata["fcpx"].(map[string]interface{})
+		if !ok {
+			t.Errorf("Expected fcpx metadata on item %d", i)
+			continue
+		}
+		note := []string{"Compound note", "Multicam note", "Sync note"}[i]
+		if fcpx["note"] != note {
+			t.Errorf("Expected note %q on item %d, got %v", note, i, fcpx["note"])
+		}
+		scene := []string{"1", "2", "3"}[i]
+		if md, _ := fcpx["metadata"].(map[string]interface{}); md["com.apple.proapps.studio.scene"] != scene {
+			t.Errorf("Expected scene %s on item %d, got %v", scene, i, fcpx["metadata"])
+		}
+	}
+
+	// The sync-clip's note isn't taken for the clip it holds
+	if _, ok := children[2].Metadata()["fcpx"]; ok {
+		t.Errorf("Expected no fcpx metadata on the synced clip, got %v", children[2].Metadata()["fcpx"])
+	}
+}
+
+// rolesFCPXML holds a spine clip with dialogue, connected music and effects
+// clips, and a second dialogue clip overlapping the first.
+const rolesFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Interview" start="0s" duration="100s" hasVideo="1" hasAudio="1" format="r1" src="file:///media/interview.mov"/>
+		<asset id="r3" name="Score" start="0s" duration="100s" hasAudio="1" src="file:///media/score.wav"/>
+		<asset id="r4" name="Door" start="0s" duration="100s" hasAudio="1" src="file:///media/door.wav"/>
+		<asset id="r5" name="Lav" start="0s" duration="100s" hasAudio="1" src="file:///media/lav.wav"/>
+	</resources>
+	<project name="Roles">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Interview" ref="r2" offset="0s" duration="10s" audioRole="dialogue.dialogue-1">
+					<asset-clip name="Score" ref="r3" lane="-1" offset="0s" duration="5s" audioRole="music"/>
+					<asset-clip name="Door" ref="r4" lane="-1" offset="5s" duration="5s" audioRole="effects.effects-1"/>
+					<audio name="Lav" ref="r5" lane="-2" offset="2s" duration="2s" role="dialogue.dialogue-2"/>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_AudioRoleTracks(t *testing.T) {
+	tests := []struct {
+		name     string
+		grouping TrackGrouping
+		tracks   []string
+	}{
+		{"lanes", GroupByLane, []string{"Audio 1", "Audio 2", "Audio 3"}},
+		{"roles", GroupByRole, []string{"Dialogue", "Dialogue 2", "Music", "Effects"}},
+		{"subroles", GroupBySubrole, []string{"Dialogue-1", "Dialogue-2", "Music-1", "Effects-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(rolesFCPXML))
+			decoder.SetOptions(DecoderOptions{AudioTracks: tt.grouping})
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Failed to decode FCPX XML: %v", err)
+			}
+
+			audioTracks := timeline.AudioTracks()
+			var names []string
+			for _, track := range audioTracks {
+				names = append(names, track.Name())
+			}
+			if strings.Join(names, ", ") != strings.Join(tt.tracks, ", ") {
+				t.Errorf("Expected audio tracks %v, got %v", tt.tracks, names)
+			}
+		})
+	}
+
+	// Role tracks hold only the clips of their role, and clips keep their role
+	decoder := NewDecoder(strings.NewReader(rolesFCPXML))
+	decoder.SetOptions(DecoderOptions{AudioTracks: GroupByRole})
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+	for _, track := range timeline.AudioTracks() {
+		role, _ := track.Metadata()["fcpx_audio_role"].(string)
+		for _, child := range track.Children() {
+			clip, ok := child.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			clipRole, _ := clip.Metadata()["fcpx_audio_role"].(string)
+			if !strings.HasPrefix(clipRole, role) {
+				t.Errorf("Clip %q with role %q is on the %q track", clip.Name(), clipRole, track.Name())
+			}
+		}
+	}
+}
+
+// videoRolesFCPXML holds a spine clip with connected graphics and a title
+// rendered to video, each with its own video role.
+const videoRolesFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Interview" start="0s" duration="100s" hasVideo="1" format="r1" src="file:///media/interview.mov"/>
+		<asset id="r3" name="Logo" start="0s" duration="100s" hasVideo="1" format="r1" src="file:///media/logo.mov"/>
+		<asset id="r4" name="Lower Third" start="0s" duration="100s" hasVideo="1" format="r1" src="file:///media/lower-third.mov"/>
+	</resources>
+	<project name="Video Roles">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Interview" ref="r2" offset="0s" duration="10s" videoRole="video.video-1">
+					<asset-clip name="Logo" ref="r3" lane="1" offset="2s" duration="2s" videoRole="graphics"/>
+					<video name="Lower Third" ref="r4" lane="2" offset="5s" duration="3s" role="titles.titles-1"/>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_VideoRoleTracks(t *testing.T) {
+	tests := []struct {
+		name     string
+		grouping TrackGrouping
+		tracks   []string
+	}{
+		{"lanes", GroupByLane, []string{"Video 1", "Video 2", "Video 3"}},
+		{"roles", GroupByRole, []string{"Video", "Titles", "Graphics"}},
+		{"subroles", GroupBySubrole, []string{"Video-1", "Titles-1", "Graphics-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder := NewDecoder(strings.NewReader(videoRolesFCPXML))
+			decoder.SetOptions(DecoderOptions{VideoTracks: tt.grouping})
+			timeline, err := decoder.Decode()
+			if err != nil {
+				t.Fatalf("Failed to decode FCPX XML: %v", err)
+			}
+
+			var names []string
+			for _, track := range timeline.VideoTracks() {
+				names = append(names, track.Name())
+			}
+			if strings.Join(names, ", ") != strings.Join(tt.tracks, ", ") {
+				t.Errorf("Expected video tracks %v, got %v", tt.tracks, names)
+			}
+		})
+	}
+
+	timeline, err := NewDecoder(strings.NewReader(videoRolesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+	roles := map[string]string{
+		"Interview":   "video.video-1",
+		"Logo":        "graphics",
+		"Lower Third": "titles.titles-1",
+	}
+	for _, clip := range timeline.FindClips(nil, false) {
+		if role := clip.Metadata()["fcpx_video_role"]; role != roles[clip.Name()] {
+			t.Errorf("Clip %q: expected video role %q, got %v", clip.Name(), roles[clip.Name()], role)
+		}
+	}
+}
+
+// titlesFCPXML holds a solid color generator on the spine with a title
+// connected above it.
+const titlesFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<effect id="r2" name="Basic Title" uid=".../Titles.localized/Bumper:Opener.localized/Basic Title.localized/Basic Title.moti"/>
+		<effect id="r3" name="Custom" uid=".../Generators.localized/Solids.localized/Custom.localized/Custom.motn"/>
+	</resources>
+	<project name="Titles">
+		<sequence format="r1">
+			<spine>
+				<video name="Backdrop" ref="r3" offset="0s" start="3600s" duration="5s">
+					<param name="Color" key="9999/10003/13260/3296672360/2/314/315" value="0 0 1"/>
+					<title name="Opening" ref="r2" lane="1" offset="3601s" start="3600s" duration="3s" role="titles.titles-1">
+						<param name="Position" key="9999/999166631/999166633/1/100/101" value="0 -450"/>
+						<text>
+							<text-style ref="ts1">Hello </text-style>
+							<text-style ref="ts2">World</text-style>
+						</text>
+						<text>
+							<text-style ref="ts1">Second line</text-style>
+						</text>
+						<text-style-def id="ts1">
+							<text-style font="Helvetica" fontSize="63" fontColor="1 1 1 1" alignment="center"/>
+						</text-style-def>
+						<text-style-def id="ts2">
+							<text-style font="Helvetica" fontSize="63" bold="1"/>
+						</text-style-def>
+					</title>
+				</video>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_TitlesAndGenerators(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(titlesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+
+	// The generator on the spine
+	backdrop, ok := videoTracks[0].Children()[0].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected a clip on the spine, got %T", videoTracks[0].Children()[0])
+	}
+	generator, ok := backdrop.MediaReference().(*gotio.GeneratorReference)
+	if !ok {
+		t.Fatalf("Expected a generator reference, got %T", backdrop.MediaReference())
+	}
+	if generator.GeneratorKind() != "Custom" {
+		t.Errorf("Expected generator kind 'Custom', got %q", generator.GeneratorKind())
+	}
+	params, _ := generator.Parameters()["params"].([]interface{})
+	if len(params) != 1 || params[0].(map[string]interface{})["value"] != "0 0 1" {
+		t.Errorf("Expected the color param, got %v", generator.Parameters()["params"])
+	}
+
+	// The title connected above it, after a 1s gap
+	children := videoTracks[1].Children()
+	if len(children) != 2 {
+		t.Fatalf("Expected a gap and the title, got %d items", len(children))
+	}
+	title, ok := children[1].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected the title clip, got %T", children[1])
+	}
+	if title.Name() != "Opening" || title.Metadata()["fcpx_video_role"] != "titles.titles-1" {
+		t.Errorf("Expected the Opening title with its role, got %q %v", title.Name(), title.Metadata())
+	}
+	generator, ok = title.MediaReference().(*gotio.GeneratorReference)
+	if !ok {
+		t.Fatalf("Expected a generator reference, got %T", title.MediaReference())
+	}
+	parameters := generator.Parameters()
+	if generator.GeneratorKind() != "Basic Title" {
+		t.Errorf("Expected generator kind 'Basic Title', got %q", generator.GeneratorKind())
+	}
+	if !strings.HasSuffix(parameters["effect_uid"].(string), "Basic Title.moti") {
+		t.Errorf("Expected the title's effect uid, got %v", parameters["effect_uid"])
+	}
+	if parameters["text"] != "Hello World\nSecond line" {
+		t.Errorf("Expected the title text, got %q", parameters["text"])
+	}
+	runs, _ := parameters["text_styles"].([]interface{})
+	if len(runs) != 3 {
+		t.Fatalf("Expected 3 text runs, got %d", len(runs))
+	}
+	world := runs[1].(map[string]interface{})
+	if world["text"] != "World\n" || world["bold"] != "1" || world["font"] != "Helvetica" {
+		t.Errorf("Expected the bold World run ending the first line, got %v", world)
+	}
+}
+
+// captionsFCPXML holds two clips on the spine with English iTT captions and
+// a CEA-608 caption connected to them.
+const captionsFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Interview" src="file:///media/interview.mov" start="0s" duration="20s" hasVideo="1"/>
+	</resources>
+	<project name="Captions">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Interview A" ref="r2" offset="0s" start="0s" duration="5s">
+					<caption name="Hello" lane="1" offset="1s" start="3600s" duration="2s" role="iTT?captionFormat=ITT.en">
+						<text placement="bottom">
+							<text-style ref="ts1">Hello</text-style>
+						</text>
+						<text-style-def id="ts1">
+							<text-style font=".AppleSystemUIFont" fontSize="13" fontColor="1 1 1 1" backgroundColor="0 0 0 1"/>
+						</text-style-def>
+					</caption>
+					<caption name="Hi" lane="2" offset="1s" start="3600s" duration="2s" role="CEA-608?captionFormat=608.en">
+						<text display-style="pop-on" position="0 85" alignment="center">
+							<text-style ref="ts2">Hi</text-style>
+						</text>
+						<text-style-def id="ts2">
+							<text-style font="Menlo" fontSize="13" fontColor="1 1 1 1" backgroundColor="0 0 0 1"/>
+						</text-style-def>
+					</caption>
+				</asset-clip>
+				<asset-clip name="Interview B" ref="r2" offset="5s" start="10s" duration="5s">
+					<caption name="Goodbye" lane="1" offset="11s" start="3600s" duration="3s" role="iTT?captionFormat=ITT.en">
+						<text placement="top">
+							<text-style>Good</text-style>
+						</text>
+						<text>
+							<text-style>bye</text-style>
+						</text>
+					</caption>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_Captions(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(captionsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// The picture, then a caption track per role whatever the lanes
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 3 {
+		t.Fatalf("Expected 3 video tracks, got %d", len(videoTracks))
+	}
+	cea, itt := videoTracks[1], videoTracks[2]
+	if cea.Name() != "Captions 608.en" || cea.Metadata()["fcpx_caption_role"] != "CEA-608?captionFormat=608.en" {
+		t.Errorf("Expected the CEA-608 caption track, got %q %v", cea.Name(), cea.Metadata())
+	}
+	if itt.Name() != "Captions ITT.en" || itt.Metadata()["fcpx_caption_role"] != "iTT?captionFormat=ITT.en" {
+		t.Errorf("Expected the iTT caption track, got %q %v", itt.Name(), itt.Metadata())
+	}
+
+	// Both iTT captions, with a gap before and between them
+	children := itt.Children()
+	if len(children) != 4 {
+		t.Fatalf("Expected 4 items on the iTT track, got %d", len(children))
+	}
+	hello, ok := children[1].(*gotio.Clip)
+	if !ok {
+		t.Fatalf("Expected the Hello caption, got %T", children[1])
+	}
+	if hello.Metadata()["fcpx_caption_role"] != "iTT?captionFormat=ITT.en" {
+		t.Errorf("Expected the caption's role, got %v", hello.Metadata())
+	}
+	generator, ok := hello.MediaReference().(*gotio.GeneratorReference)
+	if !ok {
+		t.Fatalf("Expected a generator reference, got %T", hello.MediaReference())
+	}
+	parameters := generator.Parameters()
+	if generator.GeneratorKind() != "Caption" || parameters["caption_format"] != "ITT.en" {
+		t.Errorf("Expected an ITT.en caption, got %q %v", generator.GeneratorKind(), parameters)
+	}
+	if parameters["text"] != "Hello" || parameters["placement"] != "bottom" {
+		t.Errorf("Expected the caption's text and placement, got %v", parameters)
+	}
+	runs, _ := parameters["text_styles"].([]interface{})
+	if len(runs) != 1 || runs[0].(map[string]interface{})["background_color"] != "0 0 0 1" {
+		t.Errorf("Expected a run with a background color, got %v", runs)
+	}
+
+	gap, ok := children[2].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected a gap between the captions, got %T", children[2])
+	}
+	if d, _ := gap.Duration(); d.ToSeconds() != 3 {
+		t.Errorf("Expected a 3s gap, got %gs", d.ToSeconds())
+	}
+	goodbye := children[3].(*gotio.Clip)
+	parameters = goodbye.MediaReference().(*gotio.GeneratorReference).Parameters()
+	if parameters["text"] != "Good\nbye" || parameters["placement"] != "top" {
+		t.Errorf("Expected the two line caption, got %v", parameters)
+	}
+
+	hi := cea.Children()[1].(*gotio.Clip)
+	parameters = hi.MediaReference().(*gotio.GeneratorReference).Parameters()
+	if parameters["display_style"] != "pop-on" || parameters["position"] != "0 85" || parameters["alignment"] != "center" {
+		t.Errorf("Expected the CEA-608 display attributes, got %v", parameters)
+	}
+}
+
+// nestedCaptionsFCPXML holds captions connected to clips inside a sync-clip
+// and an audition.
+const nestedCaptionsFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Interview" src="file:///media/interview.mov" start="0s" duration="20s" hasVideo="1"/>
+	</resources>
+	<project name="Nested Captions">
+		<sequence format="r1">
+			<spine>
+				<sync-clip name="Take 1" offset="0s" duration="5s">
+					<asset-clip name="Interview A" ref="r2" offset="0s" start="0s" duration="5s">
+						<caption name="Hello" lane="1" offset="1s" start="3600s" duration="2s" role="iTT?captionFormat=ITT.en">
+							<text>
+								<text-style>Hello</text-style>
+							</text>
+						</caption>
+					</asset-clip>
+				</sync-clip>
+				<audition offset="5s">
+					<asset-clip name="Interview B" ref="r2" offset="5s" start="10s" duration="5s">
+						<caption name="Goodbye" lane="1" offset="11s" start="3600s" duration="2s" role="iTT?captionFormat=ITT.en">
+							<text>
+								<text-style>Goodbye</text-style>
+							</text>
+						</caption>
+					</asset-clip>
+				</audition>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_NestedCaptions(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(nestedCaptionsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	// Captions in the sync-clip and the audition land on the caption track,
+	// not on an audio track
+	if audioTracks := timeline.AudioTracks(); len(audioTracks) != 0 {
+		t.Fatalf("Expected no audio tracks, got %d", len(audioTracks))
+	}
+	videoTracks := timeline.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+	itt := videoTracks[1]
+	if itt.Name() != "Captions ITT.en" {
+		t.Errorf("Expected the iTT caption track, got %q", itt.Name())
+	}
+
+	children := itt.Children()
+	if len(children) != 4 {
+		t.Fatalf("Expected 4 items on the iTT track, got %d", len(children))
+	}
+	for i, name := range []string{"Hello", "Goodbye"} {
+		caption, ok := children[2*i+1].(*gotio.Clip)
+		if !ok || caption.Name() != name {
+			t.Fatalf("Expected the %s caption, got %v", name, children[2*i+1])
+		}
+		if _, ok := caption.Metadata()["fcpx_sync_clip"]; ok {
+			t.Errorf("Expected no fcpx_sync_clip metadata on the %s caption", name)
+		}
+		if d, _ := caption.Duration(); d.ToSeconds() != 2 {
+			t.Errorf("Expected the %s caption to last 2s, got %gs", name, d.ToSeconds())
+		}
+	}
+	gap, ok := children[2].(*gotio.Gap)
+	if !ok {
+		t.Fatalf("Expected a gap between the captions, got %T", children[2])
+	}
+	if d, _ := gap.Duration(); d.ToSeconds() != 3 {
+		t.Errorf("Expected a 3s gap between the captions, got %gs", d.ToSeconds())
+	}
+}
+
+// filtersFCPXML holds an asset-clip with video filters, one animated and one
+// turned off, and an audio filter.
+const filtersFCPXML = `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Street" src="file:///media/street.mov" start="0s" duration="20s" hasVideo="1" hasAudio="1"/>
+		<effect id="r3" name="Color Board" uid="FFColorBoardEffect"/>
+		<effect id="r4" name="Gaussian Blur" uid=".../Effects.localized/Blur.localized/Gaussian.localized/Gaussian.moef"/>
+		<effect id="r5" name="Channel EQ" uid="FFAudioUnitEffect/aufx/chEQ/appl"/>
+	</resources>
+	<project name="Filters">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Street" ref="r2" offset="0s" start="2s" duration="5s">
+					<filter-video ref="r3" name="Color Board">
+						<param name="Color" key="1" value="0 0 0">
+							<param name="Master" key="1/1" value="0.1 0.2 0.3"/>
+						</param>
+						<param name="Mix" key="2" value="1">
+							<keyframeAnimation>
+								<keyframe time="2s" value="0"/>
+								<keyframe time="3s" value="1" interp="linear" curve="smooth"/>
+							</keyframeAnimation>
+						</param>
+					</filter-video>
+					<filter-video ref="r4" name="Gaussian Blur" enabled="0">
+						<param name="Amount" key="9999/gaussianBlur/amount" value="12"/>
+					</filter-video>
+					<filter-audio ref="r5" name="Channel EQ"/>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+func TestDecoder_ClipFilters(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(filtersFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	video := timeline.VideoTracks()[0].Children()[0].(*gotio.Clip)
+	effects := video.Effects()
+	if len(effects) != 2 {
+		t.Fatalf("Expected 2 video effects, got %d", len(effects))
+	}
+	colorBoard := effects[0]
+	if colorBoard.Name() != "Color Board" || colorBoard.EffectName() != "Color Board" {
+		t.Errorf("Expected the Color Board effect, got %q %q", colorBoard.Name(), colorBoard.EffectName())
+	}
+	filter, ok := colorBoard.Metadata()["fcpx_filter_video"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected the filter in metadata, got %v", colorBoard.Metadata())
+	}
+	if filter["effect_uid"] != "FFColorBoardEffect" {
+		t.Errorf("Expected the filter's effect uid, got %v", filter["effect_uid"])
+	}
+	params, _ := filter["params"].([]interface{})
+	if len(params) != 2 {
+		t.Fatalf("Expected 2 params, got %d", len(params))
+	}
+	nested, _ := params[0].(map[string]interface{})["params"].([]interface{})
+	if len(nested) != 1 || nested[0].(map[string]interface{})["value"] != "0.1 0.2 0.3" {
+		t.Errorf("Expected the nested Master param, got %v", nested)
+	}
+	keyframes, _ := params[1].(map[string]interface{})["keyframes"].([]interface{})
+	if len(keyframes) != 2 {
+		t.Fatalf("Expected 2 keyframes, got %d", len(keyframes))
+	}
+	last := keyframes[1].(map[string]interface{})
+	if last["time"] != "3s" || last["value"] != "1" || last["interp"] != "linear" || last["curve"] != "smooth" {
+		t.Errorf("Expected the second keyframe, got %v", last)
+	}
+
+	blur := effects[1]
+	filter, _ = blur.Metadata()["fcpx_filter_video"].(map[string]interface{})
+	if blur.EffectName() != "Gaussian Blur" || filter["enabled"] != "0" {
+		t.Errorf("Expected the turned off blur, got %q %v", blur.EffectName(), filter)
+	}
+
+	// The audio filter is on the audio clip only
+	audio := timeline.AudioTracks()[0].Children()[0].(*gotio.Clip)
+	if len(audio.Effects()) != 1 {
+		t.Fatalf("Expected 1 audio effect, got %d", len(audio.Effects()))
+	}
+	if _, ok := audio.Effects()[0].Metadata()["fcpx_filter_audio"]; !ok || audio.Effects()[0].EffectName() != "Channel EQ" {
+		t.Errorf("Expected the Channel EQ filter, got %q %v", audio.Effects()[0].EffectName(), audio.Effects()[0].Metadata())
+	}
+}
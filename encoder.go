@@ -7,14 +7,96 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Avalanche-io/gotio/opentime"
 	"github.com/Avalanche-io/gotio"
 )
 
+// crossDissolveUID identifies Final Cut Pro's Cross Dissolve transition.
+const crossDissolveUID = "FxPlug:4731E73A-8DAC-4113-9A30-AE85B1761265"
+
+// basicTitleUID identifies Final Cut Pro's Basic Title.
+const basicTitleUID = ".../Titles.localized/Bumper:Opener.localized/Basic Title.localized/Basic Title.moti"
+
+// defaultVersion is the FCPXML version written when EncoderOptions.Version
+// is not set.
+const defaultVersion = "1.9"
+
+// audioTimebase is the timebase of audio samples at Final Cut Pro's 48kHz
+// sample rate, to which times off the sequence's timebase are snapped.
+const audioTimebase = 48000
+
+// supportedVersions lists the FCPXML versions the Encoder can write.
+var supportedVersions = []string{"1.8", "1.9", "1.10", "1.11"}
+
+// EncoderOptions configures how an Encoder writes FCPX XML.
+type EncoderOptions struct {
+	// Version is the FCPXML version written, from "1.8" to "1.11". From 1.9
+	// asset media is located by a media-rep instead of the asset's src
+	// attribute; the rest is written the same way for every version. Empty
+	// uses 1.9.
+	Version string
+
+	// Library wraps the project in a library and event, the structure Final
+	// Cut Pro exports, instead of writing it at the document root.
+	Library bool
+
+	// LibraryLocation is the URL of the library written when Library is
+	// set, such as "file:///Volumes/Media/Edit.fcpbundle/". Empty leaves
+	// the library for Final Cut Pro to choose.
+	LibraryLocation string
+
+	// EventName names the event written when Library is set. Empty uses
+	// the timeline's name.
+	EventName string
+}
+
 // Encoder writes an OTIO Timeline as FCPX XML.
 type Encoder struct {
-	w io.Writer
+	w    io.Writer
+	opts EncoderOptions
+
+	// minorVersion is the minor number of the FCPXML version being written.
+	minorVersion int
+
+	// frameDuration is the frame duration of the sequence being written,
+	// and format its format resource.
+	frameDuration Time
+	format        *Format
+
+	// resources collects the resources the document refers to, and lastID
+	// is the number of the last resource id allocated.
+	resources *Resources
+	lastID    int
+
+	// lastTextStyle is the number of the last title text style id
+	// allocated.
+	lastTextStyle int
+
+	// assets, effects, formats and media index the resources already
+	// written, so that each is written once. Assets are indexed by target
+	// URL, effects by uid, formats by frame duration and media by the ref
+	// recorded in metadata.
+	assets  map[string]*Asset
+	effects map[string]*Effect
+	formats map[string]*Format
+	media   map[string]*Media
+
+	// withAudio holds the audio clip whose audio each video clip is written
+	// with, and videoOnly the asset-clips written for video clips without
+	// it.
+	withAudio map[*gotio.Clip]*gotio.Clip
+	videoOnly []*Clip
+
+	// syncAudio holds the audio clips decoded from each sync-clip, by the
+	// sync-clip's id.
+	syncAudio map[string][]*gotio.Clip
+
+	warnings []string
 }
 
 // NewEncoder creates a new Encoder that writes to w.
@@ -22,6 +104,16 @@ func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{w: w}
 }
 
+// SetOptions sets the options used by subsequent calls to Encode.
+func (e *Encoder) SetOptions(opts EncoderOptions) {
+	e.opts = opts
+}
+
+// Warnings returns the problems tolerated during the last call to Encode.
+func (e *Encoder) Warnings() []string {
+	return e.warnings
+}
+
 // Encode converts an OTIO Timeline to FCPX XML and writes it to the output.
 func (e *Encoder) Encode(timeline *gotio.Timeline) error {
 	// Convert OTIO Timeline to FCPXML
@@ -52,88 +144,736 @@ func (e *Encoder) Encode(timeline *gotio.Timeline) error {
 
 // convertFromTimeline converts an OTIO Timeline to FCPXML.
 func (e *Encoder) convertFromTimeline(timeline *gotio.Timeline) (*FCPXML, error) {
+	version := e.opts.Version
+	if version == "" {
+		version = defaultVersion
+	}
+	minorVersion, err := parseVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	e.minorVersion = minorVersion
+
 	// Create project
 	project := &Project{
 		Name: timeline.Name(),
 	}
 
+	e.resources = &Resources{}
+	e.lastID = 0
+	e.lastTextStyle = 0
+	e.assets = make(map[string]*Asset)
+	e.effects = make(map[string]*Effect)
+	e.formats = make(map[string]*Format)
+	e.media = make(map[string]*Media)
+	e.withAudio = make(map[*gotio.Clip]*gotio.Clip)
+	e.videoOnly = nil
+	e.warnings = nil
+
+	// Times are written in the timebase of the sequence's format
+	if err := e.convertFormat(timeline); err != nil {
+		return nil, err
+	}
+
 	// Create sequence from tracks
-	sequence, err := e.convertTracksToSequence(timeline.Tracks())
+	var origin Time
+	if start := timeline.GlobalStartTime(); start != nil {
+		origin = TimeFromRationalTime(*start)
+	}
+	sequence, err := e.convertTracksToSequence(timeline.Tracks(), origin)
 	if err != nil {
 		return nil, err
 	}
+	e.convertSequenceSettings(timeline, sequence)
 	project.Sequence = sequence
 
-	// Create FCPXML with the project
+	// Asset-clips used without their audio leave it out, once it is known
+	// which assets have audio
+	hasAudio := make(map[string]bool)
+	for _, asset := range e.resources.Assets {
+		hasAudio[asset.ID] = asset.HasAudio == "1"
+	}
+	for _, assetClip := range e.videoOnly {
+		if hasAudio[assetClip.Ref] {
+			assetClip.SrcEnable = "video"
+		}
+	}
+
+	// Create FCPXML with the project, in a library and event if asked
 	fcpxml := &FCPXML{
-		Version: "1.9",
-		Project: project,
+		Version:   version,
+		Resources: e.resources,
+	}
+	if e.opts.Library {
+		eventName := e.opts.EventName
+		if eventName == "" {
+			eventName = timeline.Name()
+		}
+		fcpxml.Library = &Library{
+			Location: e.opts.LibraryLocation,
+			Events: []*Event{{
+				Name:     eventName,
+				Projects: []*Project{project},
+			}},
+		}
+	} else {
+		fcpxml.Project = project
 	}
 
 	return fcpxml, nil
 }
 
-// convertTracksToSequence converts OTIO tracks to a FCPX Sequence.
-func (e *Encoder) convertTracksToSequence(stack *gotio.Stack) (*Sequence, error) {
-	if stack == nil {
-		return nil, fmt.Errorf("no tracks in timeline")
+// parseVersion checks that an FCPXML version can be written and returns its
+// minor number.
+func parseVersion(version string) (int, error) {
+	major, minor, ok := strings.Cut(version, ".")
+	minorVersion, err := strconv.Atoi(minor)
+	if !ok || major != "1" || err != nil {
+		return 0, fmt.Errorf("invalid FCPXML version: %q", version)
 	}
+	for _, supported := range supportedVersions {
+		if version == supported {
+			return minorVersion, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported FCPXML version %q: versions %s to %s can be written",
+		version, supportedVersions[0], supportedVersions[len(supportedVersions)-1])
+}
 
-	// Create spine
-	spine := &Spine{
-		Items: make([]interface{}, 0),
+// newID allocates the next resource id.
+func (e *Encoder) newID() string {
+	e.lastID++
+	return fmt.Sprintf("r%d", e.lastID)
+}
+
+// convertFormat creates the format resource for the timeline's sequence and
+// sets the frame duration used to write times. The format recorded in
+// metadata by the Decoder is used when present; otherwise the frame rate is
+// taken from the timeline's start time or first clip, defaulting to 24 fps.
+func (e *Encoder) convertFormat(timeline *gotio.Timeline) error {
+	format := &Format{}
+	if metadata, ok := timeline.Metadata()["fcpx_format"].(map[string]interface{}); ok {
+		format.Name, _ = metadata["name"].(string)
+		format.FrameDuration, _ = metadata["frame_duration"].(string)
+		format.Width, _ = metadata["width"].(string)
+		format.Height, _ = metadata["height"].(string)
+		format.ColorSpace, _ = metadata["color_space"].(string)
+	}
+
+	if format.FrameDuration != "" {
+		frameDuration, err := ParseTime(format.FrameDuration)
+		if err != nil {
+			return fmt.Errorf("failed to parse format frame duration: %w", err)
+		}
+		e.frameDuration = frameDuration
+		e.addFormat(format)
+		return nil
+	}
+
+	rate := 24.0
+	if start := timeline.GlobalStartTime(); start != nil && start.Rate() > 0 {
+		rate = start.Rate()
+	} else {
+		for _, clip := range timeline.FindClips(nil, false) {
+			if clip.SourceRange() != nil && clip.SourceRange().Duration().Rate() > 0 {
+				rate = clip.SourceRange().Duration().Rate()
+				break
+			}
+		}
+	}
+	e.frameDuration = TimeFromRationalTime(opentime.NewRationalTime(1, rate))
+	format.FrameDuration = e.frameDuration.String()
+	e.addFormat(format)
+
+	return nil
+}
+
+// addFormat gives the sequence's format an id and adds it to the resources.
+func (e *Encoder) addFormat(format *Format) {
+	format.ID = e.newID()
+	e.format = format
+	e.formats[format.FrameDuration] = format
+	e.resources.Formats = append(e.resources.Formats, format)
+}
+
+// formatForRate returns the id of a format resource with the given frame
+// rate, adding one with only a frame duration when neither the sequence's
+// format nor an earlier one matches.
+func (e *Encoder) formatForRate(rate float64) string {
+	frameDuration := TimeFromRationalTime(opentime.NewRationalTime(1, rate))
+	if frameDuration.Cmp(e.frameDuration) == 0 {
+		return e.format.ID
 	}
+	if format, ok := e.formats[frameDuration.String()]; ok {
+		return format.ID
+	}
+
+	format := &Format{ID: e.newID(), FrameDuration: frameDuration.String()}
+	e.formats[format.FrameDuration] = format
+	e.resources.Formats = append(e.resources.Formats, format)
+	return format.ID
+}
 
-	// Get video and audio tracks
-	var videoItems []gotio.Composable
-	var audioItems []gotio.Composable
+// convertSequenceSettings sets the sequence's start timecode from the
+// timeline's global start time, and its timecode format and audio settings
+// from metadata recorded by the Decoder.
+func (e *Encoder) convertSequenceSettings(timeline *gotio.Timeline, sequence *Sequence) {
+	if start := timeline.GlobalStartTime(); start != nil {
+		sequence.TCStart = e.formatRationalTime(*start)
+	}
+
+	metadata := timeline.Metadata()
+	sequence.TCFormat, _ = metadata["fcpx_tc_format"].(string)
+	if dropFrame, ok := metadata["fcpx_drop_frame"].(bool); ok && sequence.TCFormat == "" {
+		sequence.TCFormat = "NDF"
+		if dropFrame {
+			sequence.TCFormat = "DF"
+		}
+	}
+	sequence.AudioLayout, _ = metadata["fcpx_audio_layout"].(string)
+	sequence.AudioRate, _ = metadata["fcpx_audio_rate"].(string)
+	sequence.Note, sequence.Metadata = convertNotesToFCPX(metadata)
+}
+
+// convertTracksToSequence converts OTIO tracks to a FCPX Sequence. The first
+// video track becomes the primary storyline, or the first audio track when
+// there is no video. Every other track is connected to it on a lane of its
+// own: video tracks above the spine from lane 1 up, audio tracks below it
+// from lane -1 down. Spine items are offset from origin, the sequence's
+// start time.
+func (e *Encoder) convertTracksToSequence(stack *gotio.Stack, origin Time) (*Sequence, error) {
+	if stack == nil {
+		return nil, fmt.Errorf("no tracks in timeline")
+	}
 
+	// Get video, caption and audio tracks
+	var videoTracks, captionTracks, audioTracks []*gotio.Track
 	for _, child := range stack.Children() {
 		if track, ok := child.(*gotio.Track); ok {
-			if track.Kind() == gotio.TrackKindVideo {
-				videoItems = append(videoItems, track.Children()...)
+			if isCaptionTrack(track) {
+				captionTracks = append(captionTracks, track)
+			} else if track.Kind() == gotio.TrackKindVideo {
+				videoTracks = append(videoTracks, track)
 			} else if track.Kind() == gotio.TrackKindAudio {
-				audioItems = append(audioItems, track.Children()...)
+				audioTracks = append(audioTracks, track)
+			}
+		}
+	}
+
+	// Audio synced by a sync-clip is written inside the sync-clip, and audio
+	// from a multicam angle fills in the angle's media
+	e.syncAudio = make(map[string][]*gotio.Clip)
+	for _, track := range audioTracks {
+		for _, item := range track.Children() {
+			clip, ok := item.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			if multicam, ok := clip.Metadata()["fcpx_multicam"].(map[string]interface{}); ok {
+				e.convertMulticamToMedia(clip, multicam, false)
+			}
+			if sync, ok := clip.Metadata()["fcpx_sync_clip"].(map[string]interface{}); ok {
+				id, _ := sync["id"].(string)
+				e.syncAudio[id] = append(e.syncAudio[id], clip)
 			}
 		}
 	}
 
-	// Convert items (prioritize video items for spine, add audio separately)
-	for i, item := range videoItems {
-		fcpItem, err := e.convertItem(item, true)
+	carried, err := e.carriedAudio(videoTracks, audioTracks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create spine from the first video track
+	primary, connected := videoTracks, audioTracks
+	isVideo := true
+	if len(videoTracks) == 0 {
+		primary, connected = audioTracks, nil
+		isVideo = false
+	}
+	spine := &Spine{
+		Items: make([]interface{}, 0),
+	}
+	var hosts []storyHost
+	var end Time
+	if len(primary) > 0 {
+		items, err := e.trackItems(primary[0])
 		if err != nil {
 			return nil, err
 		}
-		if fcpItem != nil {
+		for _, ti := range items {
+			fcpItem, err := e.convertItem(ti.item, isVideo)
+			if err != nil {
+				return nil, err
+			}
+			e.trimTransition(fcpItem, ti)
+			setPosition(fcpItem, "", e.formatTime(origin.Add(ti.elementStart())))
 			spine.Items = append(spine.Items, fcpItem)
+			if ti.duration.Seconds() > timeTolerance {
+				hosts = append(hosts, storyHost{fcpItem, ti.start, ti.duration})
+			}
+			end = ti.start.Add(ti.duration)
 		}
+	}
 
-		// Add corresponding audio if available
-		if i < len(audioItems) {
-			audioItem := audioItems[i]
-			if audioClip, ok := audioItem.(*gotio.Clip); ok {
-				// Add audio to the clip
-				if clip, ok := fcpItem.(*Clip); ok {
-					audio, err := e.convertClipToAudio(audioClip)
-					if err != nil {
-						return nil, err
-					}
-					clip.Audio = audio
-				}
-			}
+	// The spine is padded with a gap to the end of the longest track, so
+	// that every connected item has something to connect to
+	trackEnd := end
+	for _, track := range append(append(videoTracks, captionTracks...), audioTracks...) {
+		items, err := e.trackItems(track)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			continue
+		}
+		last := items[len(items)-1]
+		if trackEnd.Cmp(last.start.Add(last.duration)) < 0 {
+			trackEnd = last.start.Add(last.duration)
+		}
+	}
+	if padding := trackEnd.Sub(end); padding.Seconds() > timeTolerance {
+		gap := &Gap{
+			Name:     "Gap",
+			Offset:   e.formatTime(origin.Add(end)),
+			Duration: e.formatTime(padding),
+		}
+		spine.Items = append(spine.Items, gap)
+		hosts = append(hosts, storyHost{gap, end, padding})
+		end = trackEnd
+	}
+
+	// Connect the other tracks to the spine. Tracks with nothing of their
+	// own to write, such as the audio of the spine's clips, take no lane.
+	lane := 1
+	for i := 1; i < len(primary); i++ {
+		written, err := e.connectTrack(primary[i], lane, isVideo, hosts, carried)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			lane++
+		}
+	}
+	// Captions connect above the video lanes
+	for _, track := range captionTracks {
+		written, err := e.connectTrack(track, lane, true, hosts, carried)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			lane++
+		}
+	}
+	lane = -1
+	for _, track := range connected {
+		written, err := e.connectTrack(track, lane, false, hosts, carried)
+		if err != nil {
+			return nil, err
+		}
+		if written {
+			lane--
 		}
 	}
 
 	// Create sequence
 	sequence := &Sequence{
-		Format:   "r1",
-		Duration: "",
+		Format:   e.format.ID,
+		Duration: e.formatTime(end),
 		Spine:    spine,
 	}
 
 	return sequence, nil
 }
 
+// isCaptionTrack reports whether track holds captions: it was decoded for a
+// caption role, or it has clips decoded from captions.
+func isCaptionTrack(track *gotio.Track) bool {
+	if _, ok := track.Metadata()["fcpx_caption_role"]; ok {
+		return true
+	}
+	for _, child := range track.Children() {
+		if clip, ok := child.(*gotio.Clip); ok && isCaption(clip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCaption reports whether item is a clip decoded from a caption.
+func isCaption(item gotio.Composable) bool {
+	clip, ok := item.(*gotio.Clip)
+	if !ok {
+		return false
+	}
+	generator, ok := clip.MediaReference().(*gotio.GeneratorReference)
+	return ok && generator.Metadata()["fcpx_element"] == "caption"
+}
+
+// trackItem is an item of an OTIO track with its record range in the track,
+// its range in parent. Transitions also have their in and out offsets.
+type trackItem struct {
+	item     gotio.Composable
+	start    Time
+	duration Time
+	in, out  Time
+}
+
+// trackItems returns the items of track with their record ranges, summed
+// exactly from the items' durations. Transitions take no time of their own.
+func (e *Encoder) trackItems(track *gotio.Track) ([]trackItem, error) {
+	var items []trackItem
+	var position Time
+	for _, child := range track.Children() {
+		ti := trackItem{item: child, start: position}
+		if item, ok := child.(interface {
+			Duration() (opentime.RationalTime, error)
+		}); ok {
+			rt, err := item.Duration()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get duration of %q: %w", child.Name(), err)
+			}
+			ti.duration = e.time(rt)
+		}
+		if transition, ok := child.(*gotio.Transition); ok {
+			ti.in, ti.out = e.time(transition.InOffset()), e.time(transition.OutOffset())
+			// A transition with none of it after the start of the track
+			// is left out
+			if position.IsZero() && ti.out.IsZero() {
+				continue
+			}
+		}
+		items = append(items, ti)
+		position = position.Add(ti.duration)
+	}
+	return items, nil
+}
+
+// elementStart returns where the element written for the item starts. A
+// transition starts before the cut it sits on, by its in offset, but not
+// before the start of its track.
+func (ti trackItem) elementStart() Time {
+	if _, ok := ti.item.(*gotio.Transition); ok {
+		start := ti.start.Sub(ti.in)
+		if start.Cmp(Time{}) < 0 {
+			return Time{}
+		}
+		return start
+	}
+	return ti.start
+}
+
+// trimTransition shortens the element written for a transition at the
+// start of its track by the part of it that elementStart leaves out.
+func (e *Encoder) trimTransition(element Item, ti trackItem) {
+	fcpTransition, ok := element.(*Transition)
+	if !ok {
+		return
+	}
+	if ti.in.Cmp(ti.start) > 0 {
+		fcpTransition.Duration = e.formatTime(ti.start.Add(ti.out))
+	}
+}
+
+// storyHost is a spine element that connected items can be attached to, with
+// its record range.
+type storyHost struct {
+	element  Item
+	start    Time
+	duration Time
+}
+
+// connectTrack connects the items of an OTIO track to the spine elements
+// they start over, on lane, and reports whether it connected any. Runs of
+// adjacent items become a secondary storyline; an item on its own becomes a
+// connected clip, and a Stack decoded from a storyline becomes one again.
+// Captions, which can't be in a storyline, are each connected on their own.
+// Gaps separate runs, and clips in carried are left out, as another element
+// writes them.
+func (e *Encoder) connectTrack(track *gotio.Track, lane int, isVideo bool, hosts []storyHost, carried map[*gotio.Clip]bool) (bool, error) {
+	items, err := e.trackItems(track)
+	if err != nil {
+		return false, err
+	}
+
+	written := false
+	var run []trackItem
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
+		}
+		defer func() { run = nil }()
+		written = true
+
+		var element Item
+		if len(run) == 1 {
+			element, err = e.convertItem(run[0].item, isVideo)
+			if err != nil {
+				return err
+			}
+		} else {
+			// Items of a storyline are offset from its start
+			storyline := &Spine{Items: make([]interface{}, 0, len(run))}
+			for _, ti := range run {
+				fcpItem, err := e.convertItem(ti.item, isVideo)
+				if err != nil {
+					return err
+				}
+				e.trimTransition(fcpItem, ti)
+				setPosition(fcpItem, "", e.formatTime(ti.elementStart().Sub(run[0].elementStart())))
+				storyline.Items = append(storyline.Items, fcpItem)
+			}
+			element = storyline
+		}
+
+		return e.connect(element, run[0].elementStart(), lane, hosts)
+	}
+
+	for _, ti := range items {
+		if _, ok := ti.item.(*gotio.Gap); ok {
+			if err := flush(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if clip, ok := ti.item.(*gotio.Clip); ok && carried[clip] {
+			if err := flush(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if isCaption(ti.item) {
+			if err := flush(); err != nil {
+				return false, err
+			}
+			caption, err := e.convertItem(ti.item, true)
+			if err != nil {
+				return false, err
+			}
+			if err := e.connect(caption, ti.start, lane, hosts); err != nil {
+				return false, err
+			}
+			written = true
+			continue
+		}
+		if stack, ok := ti.item.(*gotio.Stack); ok && stack.Metadata()["fcpx_storyline"] == true {
+			if err := flush(); err != nil {
+				return false, err
+			}
+			storyline, err := e.convertStackToStoryline(stack)
+			if err != nil {
+				return false, err
+			}
+			if err := e.connect(storyline, ti.start, lane, hosts); err != nil {
+				return false, err
+			}
+			written = true
+			continue
+		}
+		run = append(run, ti)
+	}
+	if err := flush(); err != nil {
+		return false, err
+	}
+	return written, nil
+}
+
+// convertStackToStoryline converts an OTIO Stack decoded from a secondary
+// storyline back to a FCPX Spine, laid out from the stack's tracks like a
+// sequence's spine.
+func (e *Encoder) convertStackToStoryline(stack *gotio.Stack) (*Spine, error) {
+	syncAudio := e.syncAudio
+	sequence, err := e.convertTracksToSequence(stack, Time{})
+	e.syncAudio = syncAudio
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert storyline %q: %w", stack.Name(), err)
+	}
+	sequence.Spine.Name = stack.Name()
+	return sequence.Spine, nil
+}
+
+// connect attaches a connected element starting at record time start to the
+// spine element it starts over, on lane. Its offset is in the time of that
+// element, which begins at the element's start.
+func (e *Encoder) connect(element Item, start Time, lane int, hosts []storyHost) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("no spine item to connect the item at %gs to", start.Seconds())
+	}
+
+	host := hosts[len(hosts)-1]
+	for _, h := range hosts {
+		if h.start.Add(h.duration).Cmp(start) > 0 {
+			host = h
+			break
+		}
+	}
+
+	hostStart, connected := storyElements(host.element)
+	if connected == nil {
+		return fmt.Errorf("can't connect items to %T", host.element)
+	}
+	var localStart Time
+	if hostStart != "" {
+		t, err := ParseTime(hostStart)
+		if err != nil {
+			return fmt.Errorf("failed to parse start of connecting item: %w", err)
+		}
+		localStart = t
+	}
+
+	offset := e.formatTime(localStart.Add(start.Sub(host.start)))
+	setPosition(element, strconv.Itoa(lane), offset)
+	*connected = append(*connected, element)
+
+	return nil
+}
+
+// storyElements returns the start of a story element and the elements
+// connected to it, or nil elements for story elements that can't have
+// connected items.
+func storyElements(element Item) (string, *StoryElements) {
+	switch v := element.(type) {
+	case *Clip:
+		return v.Start, &v.Items
+	case *Video:
+		return v.Start, &v.Items
+	case *Audio:
+		return v.Start, &v.Items
+	case *Gap:
+		return v.Start, &v.Items
+	case *Title:
+		return v.Start, &v.Items
+	case *Caption:
+		return v.Start, &v.Items
+	case *RefClip:
+		return v.Start, &v.Items
+	case *MCClip:
+		return v.Start, &v.Items
+	case *SyncClip:
+		return v.Start, &v.Items
+	}
+	return "", nil
+}
+
+// setPosition sets the lane and offset of a story element. An empty lane
+// leaves the element in its parent's storyline.
+func setPosition(element Item, lane, offset string) {
+	switch v := element.(type) {
+	case *Transition:
+		v.Offset = offset
+	case *Clip:
+		v.Lane, v.Offset = lane, offset
+	case *Video:
+		v.Lane, v.Offset = lane, offset
+	case *Audio:
+		v.Lane, v.Offset = lane, offset
+	case *Gap:
+		v.Lane, v.Offset = lane, offset
+	case *Title:
+		v.Lane, v.Offset = lane, offset
+	case *Caption:
+		v.Lane, v.Offset = lane, offset
+	case *RefClip:
+		v.Lane, v.Offset = lane, offset
+	case *MCClip:
+		v.Lane, v.Offset = lane, offset
+	case *SyncClip:
+		v.Lane, v.Offset = lane, offset
+	case *Spine:
+		v.Lane, v.Offset = lane, offset
+	}
+}
+
+// carriedAudio finds the audio clips that the video clips at the same place
+// already write: the audio of an asset-clip's media, the audio angle of a
+// multicam clip and the audio synced by a sync-clip. Video clips that carry
+// their audio are recorded, so that other asset-clips can be limited to
+// their video.
+func (e *Encoder) carriedAudio(videoTracks, audioTracks []*gotio.Track) (map[*gotio.Clip]bool, error) {
+	var videoClips []trackItem
+	syncIDs := make(map[string]bool)
+	for _, track := range videoTracks {
+		items, err := e.trackItems(track)
+		if err != nil {
+			return nil, err
+		}
+		for _, ti := range items {
+			clip, ok := ti.item.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			videoClips = append(videoClips, ti)
+			if sync, ok := clip.Metadata()["fcpx_sync_clip"].(map[string]interface{}); ok {
+				id, _ := sync["id"].(string)
+				syncIDs[id] = true
+			}
+		}
+	}
+
+	carried := make(map[*gotio.Clip]bool)
+	for _, track := range audioTracks {
+		items, err := e.trackItems(track)
+		if err != nil {
+			return nil, err
+		}
+		for _, ti := range items {
+			clip, ok := ti.item.(*gotio.Clip)
+			if !ok {
+				continue
+			}
+			if sync, ok := clip.Metadata()["fcpx_sync_clip"].(map[string]interface{}); ok {
+				id, _ := sync["id"].(string)
+				if syncIDs[id] {
+					carried[clip] = true
+				}
+				continue
+			}
+			for _, video := range videoClips {
+				videoClip := video.item.(*gotio.Clip)
+				if e.withAudio[videoClip] != nil || !sameRange(ti, video) || !carriesAudio(videoClip, clip) {
+					continue
+				}
+				carried[clip] = true
+				e.withAudio[videoClip] = clip
+				e.convertAsset(clip, false)
+				break
+			}
+		}
+	}
+
+	return carried, nil
+}
+
+// sameRange reports whether two track items have the same record range.
+func sameRange(a, b trackItem) bool {
+	return math.Abs(a.start.Sub(b.start).Seconds()) <= timeTolerance &&
+		math.Abs(a.duration.Sub(b.duration).Seconds()) <= timeTolerance
+}
+
+// carriesAudio reports whether the element written for a video clip plays
+// an audio clip: the two are cut from the same multicam clip, or from the
+// same media at the same source time.
+func carriesAudio(video, audio *gotio.Clip) bool {
+	videoMulticam, videoOK := video.Metadata()["fcpx_multicam"].(map[string]interface{})
+	audioMulticam, audioOK := audio.Metadata()["fcpx_multicam"].(map[string]interface{})
+	if videoOK || audioOK {
+		return videoOK && audioOK && videoMulticam["ref"] == audioMulticam["ref"]
+	}
+
+	videoRef, ok := video.MediaReference().(*gotio.ExternalReference)
+	if !ok || videoRef.TargetURL() == "" {
+		return false
+	}
+	audioRef, ok := audio.MediaReference().(*gotio.ExternalReference)
+	if !ok || audioRef.TargetURL() != videoRef.TargetURL() {
+		return false
+	}
+	if video.SourceRange() == nil || audio.SourceRange() == nil {
+		return video.SourceRange() == audio.SourceRange()
+	}
+	return math.Abs(subTime(video.SourceRange().StartTime(), audio.SourceRange().StartTime()).ToSeconds()) <= timeTolerance
+}
+
 // convertItem converts an OTIO Composable to a FCPX Item.
 func (e *Encoder) convertItem(item gotio.Composable, isVideo bool) (Item, error) {
 	switch v := item.(type) {
@@ -142,7 +882,9 @@ func (e *Encoder) convertItem(item gotio.Composable, isVideo bool) (Item, error)
 	case *gotio.Gap:
 		return e.convertGapToFCPX(v)
 	case *gotio.Stack:
-		return e.convertStackToRefClip(v)
+		return e.convertStackToRefClip(v, isVideo)
+	case *gotio.Transition:
+		return e.convertTransitionToFCPX(v)
 	default:
 		return nil, fmt.Errorf("unsupported item type: %T", item)
 	}
@@ -163,10 +905,50 @@ func (e *Encoder) convertClipToFCPX(clip *gotio.Clip, isVideo bool) (Item, error
 	}
 
 	// Convert markers
-	var markers []*Marker
-	for _, m := range clip.Markers() {
-		marker := e.convertMarkerToFCPX(m)
-		markers = append(markers, marker)
+	marks := e.convertMarkersToFCPX(clip.Markers())
+
+	// Generated clips are written as titles or generators using their effect
+	if generator, ok := clip.MediaReference().(*gotio.GeneratorReference); ok && isVideo {
+		return e.convertGeneratorToFCPX(clip, generator, start, duration, marks), nil
+	}
+
+	// Clips cut from a multicam clip are written back as a use of it
+	if multicam, ok := clip.Metadata()["fcpx_multicam"].(map[string]interface{}); ok {
+		return e.convertMulticamClipToFCPX(clip, multicam, start, duration, marks), nil
+	}
+
+	// Video synced with audio is written back as a sync-clip
+	if sync, ok := clip.Metadata()["fcpx_sync_clip"].(map[string]interface{}); ok && isVideo {
+		return e.convertSyncClipToFCPX(clip, sync, start, duration, marks), nil
+	}
+
+	// Clips of media files are written as uses of an asset
+	if asset := e.convertAsset(clip, isVideo); asset != nil {
+		assetClip := &Clip{
+			XMLName:  xml.Name{Local: "asset-clip"},
+			Name:     clip.Name(),
+			Ref:      asset.ID,
+			Duration: e.formatRationalTime(duration),
+			Start:    e.formatRationalTime(start),
+			Markers:  marks.markers,
+		}
+		assetClip.ChapterMarkers = marks.chapters
+		assetClip.Keywords = marks.keywords
+		assetClip.Ratings = marks.ratings
+		assetClip.Note, assetClip.Metadata = convertNotesToFCPX(clip.Metadata())
+		assetClip.AudioRole, _ = clip.Metadata()["fcpx_audio_role"].(string)
+		if isVideo {
+			assetClip.VideoRole, _ = clip.Metadata()["fcpx_video_role"].(string)
+		}
+		if !isVideo {
+			assetClip.SrcEnable = "audio"
+		} else if e.withAudio[clip] == nil {
+			e.videoOnly = append(e.videoOnly, assetClip)
+		}
+		assetClip.TimeMap = e.convertTimeMap(clip.Effects(), clip.Metadata(), start, duration)
+		assetClip.ConformRate = e.convertConformRate(clip.Metadata())
+		assetClip.FilterVideos, assetClip.FilterAudios = e.convertClipFilters(clip, isVideo)
+		return assetClip, nil
 	}
 
 	if isVideo {
@@ -175,8 +957,15 @@ func (e *Encoder) convertClipToFCPX(clip *gotio.Clip, isVideo bool) (Item, error
 			Name:     clip.Name(),
 			Duration: e.formatRationalTime(duration),
 			Start:    e.formatRationalTime(start),
-			Markers:  markers,
+			Markers:  marks.markers,
 		}
+		video.ChapterMarkers = marks.chapters
+		video.Keywords = marks.keywords
+		video.Ratings = marks.ratings
+		video.Role, _ = clip.Metadata()["fcpx_video_role"].(string)
+		video.TimeMap = e.convertTimeMap(clip.Effects(), clip.Metadata(), start, duration)
+		video.ConformRate = e.convertConformRate(clip.Metadata())
+		video.FilterVideos, _ = e.convertFiltersToFCPX(clip.Effects(), true)
 		return video, nil
 	}
 
@@ -186,28 +975,395 @@ func (e *Encoder) convertClipToFCPX(clip *gotio.Clip, isVideo bool) (Item, error
 		Duration: e.formatRationalTime(duration),
 		Start:    e.formatRationalTime(start),
 	}
+	audio.Role, _ = clip.Metadata()["fcpx_audio_role"].(string)
+	audio.TimeMap = e.convertTimeMap(clip.Effects(), clip.Metadata(), start, duration)
+	_, audio.FilterAudios = e.convertFiltersToFCPX(clip.Effects(), false)
 	return audio, nil
 }
 
-// convertClipToAudio converts an OTIO Clip to a FCPX Audio element.
-func (e *Encoder) convertClipToAudio(clip *gotio.Clip) (*Audio, error) {
-	duration, err := clip.Duration()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get clip duration: %w", err)
+// convertGeneratorToFCPX converts an OTIO Clip with a GeneratorReference to a
+// FCPX Title, or a Video using a generator effect. Clips decoded from a
+// title, or whose generator has text, are written as titles. Titles without
+// an effect uid use the Basic Title, and other generators without one are
+// written as gaps.
+func (e *Encoder) convertGeneratorToFCPX(clip *gotio.Clip, generator *gotio.GeneratorReference, start, duration opentime.RationalTime, marks *markerItems) Item {
+	parameters := generator.Parameters()
+	if isCaption(clip) {
+		return e.convertCaptionToFCPX(clip, parameters, start, duration)
 	}
 
-	var start opentime.RationalTime
-	if clip.SourceRange() != nil {
-		start = clip.SourceRange().StartTime()
+	values, _ := parameters["params"].([]interface{})
+	role, _ := clip.Metadata()["fcpx_video_role"].(string)
+
+	uid, _ := parameters["effect_uid"].(string)
+	element, _ := generator.Metadata()["fcpx_element"].(string)
+	_, hasText := parameters["text"]
+	if element == "video" || (element == "" && !hasText) {
+		if uid == "" {
+			e.warnings = append(e.warnings, fmt.Sprintf("wrote generator %q without an effect uid as a gap", clip.Name()))
+			return &Gap{Name: clip.Name(), Duration: e.formatRationalTime(duration)}
+		}
+		video := &Video{
+			Name:     clip.Name(),
+			Ref:      e.convertEffect(generator.GeneratorKind(), uid).ID,
+			Duration: e.formatRationalTime(duration),
+			Start:    e.formatRationalTime(start),
+			Markers:  marks.markers,
+		}
+		video.ChapterMarkers = marks.chapters
+		video.Keywords = marks.keywords
+		video.Ratings = marks.ratings
+		video.Role = role
+		video.Params = convertParamsToFCPX(values)
+		video.FilterVideos, _ = e.convertFiltersToFCPX(clip.Effects(), true)
+		return video
 	}
 
-	audio := &Audio{
+	name := generator.GeneratorKind()
+	if uid == "" {
+		name, uid = "Basic Title", basicTitleUID
+	}
+	title := &Title{
 		Name:     clip.Name(),
+		Ref:      e.convertEffect(name, uid).ID,
 		Duration: e.formatRationalTime(duration),
 		Start:    e.formatRationalTime(start),
+		Role:     role,
 	}
+	title.Params = convertParamsToFCPX(values)
+	title.Texts, title.TextStyleDefs = e.convertTextToFCPX(parameters)
+	title.FilterVideos, _ = e.convertFiltersToFCPX(clip.Effects(), true)
+	return title
+}
 
-	return audio, nil
+// convertCaptionToFCPX converts an OTIO Clip decoded from a caption back to
+// a FCPX Caption. Its role is the one recorded in "fcpx_caption_role"
+// metadata, or else made from the generator's caption format.
+func (e *Encoder) convertCaptionToFCPX(clip *gotio.Clip, parameters map[string]interface{}, start, duration opentime.RationalTime) *Caption {
+	caption := &Caption{
+		Name:     clip.Name(),
+		Duration: e.formatRationalTime(duration),
+		Start:    e.formatRationalTime(start),
+	}
+	caption.Role, _ = clip.Metadata()["fcpx_caption_role"].(string)
+	if format, _ := parameters["caption_format"].(string); caption.Role == "" && format != "" {
+		caption.Role = captionRole(format)
+	}
+
+	caption.Texts, caption.TextStyleDefs = e.convertTextToFCPX(parameters)
+	if len(caption.Texts) > 0 {
+		text := caption.Texts[0]
+		text.DisplayStyle, _ = parameters["display_style"].(string)
+		text.RollUpHeight, _ = parameters["roll_up_height"].(string)
+		text.Position, _ = parameters["position"].(string)
+		text.Placement, _ = parameters["placement"].(string)
+		text.Alignment, _ = parameters["alignment"].(string)
+	}
+	return caption
+}
+
+// captionRole returns the role for captions in format, such as
+// "iTT?captionFormat=ITT.en" for "ITT.en". The role is named after the
+// format's first part: iTT, CEA-608 or SRT.
+func captionRole(format string) string {
+	name := format
+	if i := strings.Index(format, "."); i >= 0 {
+		name = format[:i]
+	}
+	switch name {
+	case "ITT":
+		name = "iTT"
+	case "608":
+		name = "CEA-608"
+	}
+	return name + "?captionFormat=" + format
+}
+
+// convertTextToFCPX converts the text recorded in a generator's parameters
+// to a title's or caption's text, defining a text style for each styled
+// run. Text without runs is written as a single unstyled run, and text
+// edited since it was decoded as a single run in the first run's style.
+func (e *Encoder) convertTextToFCPX(parameters map[string]interface{}) ([]*Text, []*TextStyleDef) {
+	content, _ := parameters["text"].(string)
+	runs, _ := parameters["text_styles"].([]interface{})
+	var decoded []string
+	for _, value := range runs {
+		if run, ok := value.(map[string]interface{}); ok {
+			text, _ := run["text"].(string)
+			decoded = append(decoded, text)
+		}
+	}
+	if content != "" && content != strings.Join(decoded, "") {
+		if len(runs) > 1 {
+			runs = runs[:1]
+		}
+		if len(runs) == 0 {
+			runs = []interface{}{map[string]interface{}{}}
+		}
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+
+	text := &Text{}
+	var defs []*TextStyleDef
+	for _, value := range runs {
+		run, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		style := &TextStyle{}
+		style.Text, _ = run["text"].(string)
+		if len(runs) == 1 && content != "" {
+			style.Text = content
+		}
+
+		def := &TextStyle{}
+		def.Font, _ = run["font"].(string)
+		def.FontSize, _ = run["font_size"].(string)
+		def.FontFace, _ = run["font_face"].(string)
+		def.FontColor, _ = run["font_color"].(string)
+		def.Bold, _ = run["bold"].(string)
+		def.Italic, _ = run["italic"].(string)
+		def.Alignment, _ = run["alignment"].(string)
+		def.LineSpacing, _ = run["line_spacing"].(string)
+		def.BackgroundColor, _ = run["background_color"].(string)
+		if *def != (TextStyle{}) {
+			e.lastTextStyle++
+			style.Ref = fmt.Sprintf("ts%d", e.lastTextStyle)
+			defs = append(defs, &TextStyleDef{ID: style.Ref, TextStyle: def})
+		}
+		text.TextStyles = append(text.TextStyles, style)
+	}
+	return []*Text{text}, defs
+}
+
+// convertMulticamClipToFCPX converts an OTIO Clip decoded from a multicam
+// clip back to a FCPX MCClip, using the angles recorded in its metadata.
+func (e *Encoder) convertMulticamClipToFCPX(clip *gotio.Clip, multicam map[string]interface{}, start, duration opentime.RationalTime, marks *markerItems) *MCClip {
+	// The clip's source range is in its angle's media time
+	start = addTime(start, metadataTime(multicam, "source_offset"))
+
+	mcClip := &MCClip{
+		Name:     clip.Name(),
+		Duration: e.formatRationalTime(duration),
+		Start:    e.formatRationalTime(start),
+		Markers:  marks.markers,
+	}
+	mcClip.ChapterMarkers = marks.chapters
+	mcClip.Keywords = marks.keywords
+	mcClip.Ratings = marks.ratings
+	mcClip.Ref = e.convertMulticamToMedia(clip, multicam, true).ID
+	mcClip.TimeMap = e.convertTimeMap(clip.Effects(), clip.Metadata(), start, duration)
+	mcClip.ConformRate = e.convertConformRate(clip.Metadata())
+	mcClip.Note, mcClip.Metadata = convertNotesToFCPX(clip.Metadata())
+
+	videoAngle, _ := multicam["video_angle_id"].(string)
+	audioAngle, _ := multicam["audio_angle_id"].(string)
+	angleID, _ := multicam["angle_id"].(string)
+	mcClip.FilterVideos, mcClip.FilterAudios = e.convertClipFilters(clip, angleID == videoAngle)
+	if videoAngle != "" && videoAngle == audioAngle {
+		mcClip.Sources = []*MCSource{{AngleID: videoAngle, SrcEnable: "all"}}
+		return mcClip
+	}
+	if videoAngle != "" {
+		mcClip.Sources = append(mcClip.Sources, &MCSource{AngleID: videoAngle, SrcEnable: "video"})
+	}
+	if audioAngle != "" {
+		mcClip.Sources = append(mcClip.Sources, &MCSource{AngleID: audioAngle, SrcEnable: "audio"})
+	}
+
+	return mcClip
+}
+
+// convertSyncClipToFCPX converts an OTIO Clip decoded from a sync-clip back to
+// a FCPX SyncClip holding the clip and the audio synced with it.
+func (e *Encoder) convertSyncClipToFCPX(clip *gotio.Clip, sync map[string]interface{}, start, duration opentime.RationalTime, marks *markerItems) *SyncClip {
+	// The sync-clip's time follows the video's source time, from the point
+	// the sync-clip starts
+	syncStart := subTime(start, metadataTime(sync, "offset"))
+
+	syncClip := &SyncClip{
+		Duration: e.formatRationalTime(subTime(addTime(start, duration), syncStart)),
+		Start:    e.formatRationalTime(syncStart),
+		Markers:  marks.markers,
+	}
+	syncClip.ChapterMarkers = marks.chapters
+	syncClip.Keywords = marks.keywords
+	syncClip.Ratings = marks.ratings
+	syncClip.Name, _ = sync["name"].(string)
+	syncClip.Note, syncClip.Metadata = convertNotesToFCPX(sync)
+	video := &Video{
+		Name:     clip.Name(),
+		Offset:   e.formatRationalTime(start),
+		Start:    e.formatRationalTime(start),
+		Duration: e.formatRationalTime(duration),
+	}
+	if asset := e.convertAsset(clip, true); asset != nil {
+		video.Ref = asset.ID
+	}
+	video.Role, _ = clip.Metadata()["fcpx_video_role"].(string)
+	video.FilterVideos, _ = e.convertFiltersToFCPX(clip.Effects(), true)
+	syncClip.Items = append(syncClip.Items, video)
+
+	id, _ := sync["id"].(string)
+	for _, audioClip := range e.syncAudio[id] {
+		audioDuration, err := audioClip.Duration()
+		if err != nil {
+			continue
+		}
+		var audioStart opentime.RationalTime
+		if audioClip.SourceRange() != nil {
+			audioStart = audioClip.SourceRange().StartTime()
+		}
+
+		audioSync, _ := audioClip.Metadata()["fcpx_sync_clip"].(map[string]interface{})
+		audio := &Audio{
+			Name:     audioClip.Name(),
+			Offset:   e.formatRationalTime(addTime(syncStart, metadataTime(audioSync, "offset"))),
+			Start:    e.formatRationalTime(audioStart),
+			Duration: e.formatRationalTime(audioDuration),
+		}
+		if asset := e.convertAsset(audioClip, false); asset != nil {
+			audio.Ref = asset.ID
+		}
+		audio.Role, _ = audioClip.Metadata()["fcpx_audio_role"].(string)
+		_, audio.FilterAudios = e.convertFiltersToFCPX(audioClip.Effects(), false)
+		if lane, _ := audioSync["lane"].(string); lane != "0" {
+			audio.Lane = lane
+		}
+		syncClip.Items = append(syncClip.Items, audio)
+	}
+
+	sources, _ := sync["sync_sources"].([]interface{})
+	for _, value := range sources {
+		source, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		syncSource := &SyncSource{}
+		syncSource.SourceID, _ = source["source_id"].(string)
+		roles, _ := source["audio_role_sources"].([]interface{})
+		for _, roleValue := range roles {
+			role, ok := roleValue.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			roleSource := &AudioRoleSource{}
+			roleSource.Role, _ = role["role"].(string)
+			roleSource.Active, _ = role["active"].(string)
+			syncSource.AudioRoleSources = append(syncSource.AudioRoleSources, roleSource)
+		}
+		syncClip.SyncSources = append(syncClip.SyncSources, syncSource)
+	}
+
+	return syncClip
+}
+
+// convertAsset returns the asset resource for the media file an OTIO Clip
+// references, adding it on first use, or nil if the clip has no target URL.
+// Asset attributes recorded in the reference's metadata by the Decoder are
+// written back; otherwise an asset has video or audio when it is used on a
+// track of that kind.
+func (e *Encoder) convertAsset(clip *gotio.Clip, isVideo bool) *Asset {
+	ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+	if !ok || ref.TargetURL() == "" {
+		return nil
+	}
+
+	asset, ok := e.assets[ref.TargetURL()]
+	if !ok {
+		asset = &Asset{
+			ID:   e.newID(),
+			Name: ref.Name(),
+		}
+
+		// FCPXML 1.9 moved the media's location into a media-rep
+		if e.minorVersion >= 9 {
+			asset.MediaReps = []*MediaRep{{Kind: "original-media", Src: ref.TargetURL()}}
+		} else {
+			asset.Src = ref.TargetURL()
+		}
+		if asset.Name == "" {
+			asset.Name = clip.Name()
+		}
+		if availableRange := ref.AvailableRange(); availableRange != nil {
+			asset.Start = e.formatRationalTime(availableRange.StartTime())
+			asset.Duration = e.formatRationalTime(availableRange.Duration())
+		}
+
+		metadata := ref.Metadata()
+		asset.UID, _ = metadata["fcpx_asset_uid"].(string)
+		asset.HasVideo, _ = metadata["fcpx_has_video"].(string)
+		asset.HasAudio, _ = metadata["fcpx_has_audio"].(string)
+		asset.AudioSources, _ = metadata["fcpx_audio_sources"].(string)
+		asset.AudioChannels, _ = metadata["fcpx_audio_channels"].(string)
+		asset.AudioRate, _ = metadata["fcpx_audio_rate"].(string)
+		_, asset.Metadata = convertNotesToFCPX(metadata)
+
+		e.assets[ref.TargetURL()] = asset
+		e.resources.Assets = append(e.resources.Assets, asset)
+	}
+
+	if isVideo && asset.HasVideo == "" {
+		asset.HasVideo = "1"
+	} else if !isVideo && asset.HasAudio == "" {
+		asset.HasAudio = "1"
+	}
+
+	// Video needs a format for its frame rate
+	if asset.HasVideo == "1" && asset.Format == "" {
+		asset.Format = e.format.ID
+		if availableRange := ref.AvailableRange(); availableRange != nil && availableRange.Duration().Rate() > 0 {
+			asset.Format = e.formatForRate(availableRange.Duration().Rate())
+		}
+	}
+
+	return asset
+}
+
+// convertNotesToFCPX converts the note and md entries kept under the "fcpx"
+// metadata key back to FCPX elements. Entries are written sorted by key.
+func convertNotesToFCPX(metadata map[string]interface{}) (*Note, *Metadata) {
+	fcpx, ok := metadata["fcpx"].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	var note *Note
+	if text, _ := fcpx["note"].(string); text != "" {
+		note = &Note{Text: text}
+	}
+
+	entries, _ := fcpx["metadata"].(map[string]interface{})
+	if len(entries) == 0 {
+		return note, nil
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	md := &Metadata{}
+	for _, key := range keys {
+		entry := &MD{Key: key}
+		switch value := entries[key].(type) {
+		case string:
+			entry.Value = value
+		case []string:
+			entry.Array = &MDArray{Strings: value}
+		case []interface{}:
+			entry.Array = &MDArray{}
+			for _, v := range value {
+				entry.Array.Strings = append(entry.Array.Strings, fmt.Sprint(v))
+			}
+		default:
+			entry.Value = fmt.Sprint(value)
+		}
+		md.MD = append(md.MD, entry)
+	}
+	return note, md
 }
 
 // convertGapToFCPX converts an OTIO Gap to a FCPX Gap.
@@ -225,20 +1381,263 @@ func (e *Encoder) convertGapToFCPX(gap *gotio.Gap) (Item, error) {
 	return fcpGap, nil
 }
 
-// convertMarkerToFCPX converts an OTIO Marker to a FCPX Marker.
-func (e *Encoder) convertMarkerToFCPX(marker *gotio.Marker) *Marker {
-	markedRange := marker.MarkedRange()
+// convertTransitionToFCPX converts an OTIO Transition to a FCPX Transition.
+// Filters recorded in metadata by the Decoder are written back.
+func (e *Encoder) convertTransitionToFCPX(transition *gotio.Transition) (Item, error) {
+	duration := addTime(transition.InOffset(), transition.OutOffset())
+
+	fcpTransition := &Transition{
+		Name:     transition.Name(),
+		Duration: e.formatRationalTime(duration),
+	}
+
+	if metadata := transition.Metadata(); metadata != nil {
+		if filter, ok := metadata["fcpx_filter_video"].(map[string]interface{}); ok {
+			if ref, name, params := e.convertFilterFromMetadata(filter); ref != "" {
+				fcpTransition.FilterVideo = &FilterVideo{Ref: ref, Name: name, Params: params}
+			} else {
+				e.dropEffect(name)
+			}
+		}
+		if filter, ok := metadata["fcpx_filter_audio"].(map[string]interface{}); ok {
+			if ref, name, params := e.convertFilterFromMetadata(filter); ref != "" {
+				fcpTransition.FilterAudio = &FilterAudio{Ref: ref, Name: name, Params: params}
+			} else {
+				e.dropEffect(name)
+			}
+		}
+	}
+
+	// Transitions from other sources default to a cross dissolve
+	if fcpTransition.FilterVideo == nil && fcpTransition.FilterAudio == nil &&
+		transition.TransitionType() == gotio.TransitionTypeSMPTEDissolve {
+		effect := e.convertEffect("Cross Dissolve", crossDissolveUID)
+		fcpTransition.FilterVideo = &FilterVideo{Ref: effect.ID, Name: "Cross Dissolve"}
+	}
+
+	return fcpTransition, nil
+}
+
+// convertClipFilters converts the filter effects of an OTIO Clip, and those
+// of the audio clip whose audio it is written with, to FCPX filters.
+func (e *Encoder) convertClipFilters(clip *gotio.Clip, isVideo bool) ([]*FilterVideo, []*FilterAudio) {
+	videoFilters, audioFilters := e.convertFiltersToFCPX(clip.Effects(), isVideo)
+	if audio := e.withAudio[clip]; audio != nil {
+		_, filters := e.convertFiltersToFCPX(audio.Effects(), false)
+		audioFilters = append(audioFilters, filters...)
+	}
+	return videoFilters, audioFilters
+}
+
+// convertFiltersToFCPX converts OTIO Effects to FCPX filters. Filters the
+// Decoder kept in metadata are written back as they were. Other effects,
+// apart from the time effects written as a timeMap, have no FCPX effect uid
+// to refer to, so they are dropped with a warning, as are filters whose
+// effect uid wasn't recorded.
+func (e *Encoder) convertFiltersToFCPX(effects []gotio.Effect, isVideo bool) ([]*FilterVideo, []*FilterAudio) {
+	var videoFilters []*FilterVideo
+	var audioFilters []*FilterAudio
+	for _, effect := range effects {
+		switch effect.(type) {
+		case *gotio.LinearTimeWarp, *gotio.FreezeFrame:
+			continue
+		}
+
+		metadata := effect.Metadata()
+		if filter, ok := metadata["fcpx_filter_video"].(map[string]interface{}); ok {
+			ref, name, params := e.convertFilterFromMetadata(filter)
+			if ref == "" {
+				e.dropEffect(name)
+				continue
+			}
+			fcpFilter := &FilterVideo{Ref: ref, Name: name, Params: params}
+			fcpFilter.Enabled, _ = filter["enabled"].(string)
+			videoFilters = append(videoFilters, fcpFilter)
+			continue
+		}
+		if filter, ok := metadata["fcpx_filter_audio"].(map[string]interface{}); ok {
+			ref, name, params := e.convertFilterFromMetadata(filter)
+			if ref == "" {
+				e.dropEffect(name)
+				continue
+			}
+			fcpFilter := &FilterAudio{Ref: ref, Name: name, Params: params}
+			fcpFilter.Enabled, _ = filter["enabled"].(string)
+			audioFilters = append(audioFilters, fcpFilter)
+			continue
+		}
+
+		// Effects from other sources
+		name := effect.Name()
+		if name == "" {
+			name = effect.EffectName()
+		}
+		e.dropEffect(name)
+	}
+	return videoFilters, audioFilters
+}
+
+// dropEffect warns that the effect with the given name wasn't written for
+// want of an FCPX effect uid.
+func (e *Encoder) dropEffect(name string) {
+	e.warnings = append(e.warnings, fmt.Sprintf("dropped effect %q without an FCPX effect uid", name))
+}
 
-	return &Marker{
-		Start:    e.formatRationalTime(markedRange.StartTime()),
-		Duration: e.formatRationalTime(markedRange.Duration()),
-		Value:    marker.Name(),
-		Note:     marker.Comment(),
+// convertFilterFromMetadata reads a filter written to metadata by the Decoder,
+// referencing an effect resource for the effect it was resolved to. The ref
+// is empty when no effect uid was recorded.
+func (e *Encoder) convertFilterFromMetadata(filter map[string]interface{}) (ref, name string, params []*Param) {
+	name, _ = filter["name"].(string)
+	effectName, _ := filter["effect_name"].(string)
+	effectUID, _ := filter["effect_uid"].(string)
+	if effectName == "" {
+		effectName = name
 	}
+	if effectUID != "" {
+		ref = e.convertEffect(effectName, effectUID).ID
+	}
+
+	values, _ := filter["params"].([]interface{})
+	params = convertParamsToFCPX(values)
+
+	return ref, name, params
+}
+
+// convertParamsToFCPX converts params recorded in metadata by the Decoder
+// back to FCPX params, with their keyframes and nested params.
+func convertParamsToFCPX(values []interface{}) []*Param {
+	var params []*Param
+	for _, value := range values {
+		param, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p := &Param{}
+		p.Name, _ = param["name"].(string)
+		p.Key, _ = param["key"].(string)
+		p.Value, _ = param["value"].(string)
+		p.Enabled, _ = param["enabled"].(string)
+		if keyframes, ok := param["keyframes"].([]interface{}); ok {
+			p.KeyframeAnimation = &KeyframeAnimation{}
+			for _, k := range keyframes {
+				keyframe, ok := k.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				kf := &Keyframe{}
+				kf.Time, _ = keyframe["time"].(string)
+				kf.Value, _ = keyframe["value"].(string)
+				kf.Interp, _ = keyframe["interp"].(string)
+				kf.Curve, _ = keyframe["curve"].(string)
+				p.KeyframeAnimation.Keyframes = append(p.KeyframeAnimation.Keyframes, kf)
+			}
+		}
+		nested, _ := param["params"].([]interface{})
+		p.Params = convertParamsToFCPX(nested)
+		params = append(params, p)
+	}
+	return params
+}
+
+// convertEffect returns the effect resource with the given name and uid,
+// adding it on first use. Final Cut Pro requires the uid, so callers check
+// they have one.
+func (e *Encoder) convertEffect(name, uid string) *Effect {
+	if effect, ok := e.effects[uid]; ok {
+		return effect
+	}
+
+	effect := &Effect{ID: e.newID(), Name: name, UID: uid}
+	e.effects[uid] = effect
+	e.resources.Effects = append(e.resources.Effects, effect)
+	return effect
+}
+
+// markerItems holds the FCPX marker items converted from an item's OTIO
+// Markers.
+type markerItems struct {
+	markers  []*Marker
+	chapters []*ChapterMarker
+	keywords []*Keyword
+	ratings  []*Rating
+}
+
+// convertMarkersToFCPX converts OTIO Markers to FCPX marker items. The kind
+// recorded by the Decoder in fcpx_marker_kind decides the element; markers
+// without one are chapter markers when orange and keywords when blue. Red
+// and green markers are incomplete and completed to-do markers.
+func (e *Encoder) convertMarkersToFCPX(markers []*gotio.Marker) *markerItems {
+	marks := &markerItems{}
+	for _, m := range markers {
+		markedRange := m.MarkedRange()
+		start := e.formatRationalTime(markedRange.StartTime())
+		duration := e.formatRationalTime(markedRange.Duration())
+
+		kind, _ := m.Metadata()["fcpx_marker_kind"].(string)
+		if kind == "" {
+			switch m.Color() {
+			case gotio.MarkerColorOrange:
+				kind = "chapter"
+			case gotio.MarkerColorBlue:
+				kind = "keyword"
+			}
+		}
+
+		switch kind {
+		case "chapter":
+			chapter := &ChapterMarker{
+				Start:    start,
+				Duration: duration,
+				Value:    m.Name(),
+				Note:     m.Comment(),
+			}
+			chapter.PosterOffset, _ = m.Metadata()["fcpx_poster_offset"].(string)
+			marks.chapters = append(marks.chapters, chapter)
+		case "keyword":
+			marks.keywords = append(marks.keywords, &Keyword{
+				Start:    start,
+				Duration: duration,
+				Value:    m.Name(),
+				Note:     m.Comment(),
+			})
+		case "rating":
+			rating := &Rating{
+				Start:    start,
+				Duration: duration,
+				Note:     m.Comment(),
+			}
+			rating.Value, _ = m.Metadata()["fcpx_rating"].(string)
+			if rating.Value == "" {
+				rating.Value = "favorite"
+				if m.Color() == gotio.MarkerColorBlack {
+					rating.Value = "reject"
+				}
+			}
+			if m.Name() != rating.Value {
+				rating.Name = m.Name()
+			}
+			marks.ratings = append(marks.ratings, rating)
+		default:
+			marker := &Marker{
+				Start:    start,
+				Duration: duration,
+				Value:    m.Name(),
+				Note:     m.Comment(),
+			}
+			switch m.Color() {
+			case gotio.MarkerColorGreen:
+				marker.Completed = true
+			case gotio.MarkerColorRed:
+				marker.ToDo = true
+			}
+			marks.markers = append(marks.markers, marker)
+		}
+	}
+	return marks
 }
 
 // convertStackToRefClip converts an OTIO Stack (compound clip) to a FCPX RefClip.
-func (e *Encoder) convertStackToRefClip(stack *gotio.Stack) (Item, error) {
+func (e *Encoder) convertStackToRefClip(stack *gotio.Stack, isVideo bool) (Item, error) {
 	duration, err := stack.Duration()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stack duration: %w", err)
@@ -250,39 +1649,250 @@ func (e *Encoder) convertStackToRefClip(stack *gotio.Stack) (Item, error) {
 	}
 
 	// Convert markers
-	var markers []*Marker
-	for _, m := range stack.Markers() {
-		marker := e.convertMarkerToFCPX(m)
-		markers = append(markers, marker)
-	}
+	marks := e.convertMarkersToFCPX(stack.Markers())
 
-	// Get metadata for ref ID if available
-	refID := "r1" // Default
-	if metadata := stack.Metadata(); metadata != nil {
-		if ref, ok := metadata["fcpx_ref"].(string); ok {
-			refID = ref
-		}
+	// The stack's tracks become the compound clip's media
+	media, err := e.convertStackToMedia(stack)
+	if err != nil {
+		return nil, err
 	}
 
 	refClip := &RefClip{
 		Name:     stack.Name(),
-		Ref:      refID,
+		Ref:      media.ID,
 		Duration: e.formatRationalTime(duration),
 		Start:    e.formatRationalTime(start),
-		Markers:  markers,
+		Markers:  marks.markers,
+	}
+	refClip.ChapterMarkers = marks.chapters
+	refClip.Keywords = marks.keywords
+	refClip.Ratings = marks.ratings
+	refClip.TimeMap = e.convertTimeMap(stack.Effects(), stack.Metadata(), start, duration)
+	refClip.ConformRate = e.convertConformRate(stack.Metadata())
+	refClip.Note, refClip.Metadata = convertNotesToFCPX(stack.Metadata())
+	refClip.SrcEnable, _ = stack.Metadata()["fcpx_src_enable"].(string)
+	refClip.VideoRole, _ = stack.Metadata()["fcpx_video_role"].(string)
+	refClip.FilterVideos, refClip.FilterAudios = e.convertFiltersToFCPX(stack.Effects(), isVideo)
+	if !isVideo {
+		// Compound clips on audio tracks are used for their audio
+		refClip.SrcEnable = "audio"
 	}
 
 	return refClip, nil
 }
 
-// formatRationalTime converts an OTIO RationalTime to FCPX rational time format.
+// convertStackToMedia returns the media resource holding the sequence of an
+// OTIO Stack, adding it on first use. Stacks decoded from the same media
+// share the resource, found by the ref recorded in metadata.
+func (e *Encoder) convertStackToMedia(stack *gotio.Stack) (*Media, error) {
+	key, _ := stack.Metadata()["fcpx_ref"].(string)
+	if media, ok := e.media[key]; ok && key != "" {
+		return media, nil
+	}
+
+	media := &Media{ID: e.newID(), Name: stack.Name()}
+	if key != "" {
+		e.media[key] = media
+	}
+
+	// The media's sequence is converted like the timeline's, keeping the
+	// sync-clip audio of the sequence being written
+	syncAudio := e.syncAudio
+	sequence, err := e.convertTracksToSequence(stack, Time{})
+	e.syncAudio = syncAudio
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert compound clip %q: %w", stack.Name(), err)
+	}
+	media.Sequence = sequence
+
+	e.resources.Media = append(e.resources.Media, media)
+	return media, nil
+}
+
+// convertMulticamToMedia returns the media resource for the multicam clip an
+// OTIO Clip was cut from, adding it on first use. The angles are recreated
+// from the "fcpx_multicam" metadata, and the clip's angle is given an
+// asset-clip for the clip's media, placed so that the clip's source time
+// lines up with multicam time.
+func (e *Encoder) convertMulticamToMedia(clip *gotio.Clip, multicam map[string]interface{}, isVideo bool) *Media {
+	key, _ := multicam["ref"].(string)
+	key = "multicam:" + key
+	media, ok := e.media[key]
+	if !ok {
+		media = &Media{
+			ID:       e.newID(),
+			Name:     clip.Name(),
+			Multicam: &Multicam{Format: e.format.ID},
+		}
+		angles, _ := multicam["angles"].([]interface{})
+		for _, value := range angles {
+			angle, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			mcAngle := &MCAngle{}
+			mcAngle.Name, _ = angle["name"].(string)
+			mcAngle.AngleID, _ = angle["angle_id"].(string)
+			media.Multicam.Angles = append(media.Multicam.Angles, mcAngle)
+		}
+		e.media[key] = media
+		e.resources.Media = append(e.resources.Media, media)
+	}
+
+	angleID, _ := multicam["angle_id"].(string)
+	for _, angle := range media.Multicam.Angles {
+		if angle.AngleID != angleID || len(angle.Items) > 0 {
+			continue
+		}
+		asset := e.convertAsset(clip, isVideo)
+		if asset == nil {
+			break
+		}
+
+		// The asset-clip covers the media that is available, or else the
+		// part of it the clip uses
+		start, duration := opentime.NewRationalTime(0, 1), opentime.NewRationalTime(0, 1)
+		if availableRange := clip.MediaReference().AvailableRange(); availableRange != nil {
+			start, duration = availableRange.StartTime(), availableRange.Duration()
+		} else if clip.SourceRange() != nil {
+			start, duration = clip.SourceRange().StartTime(), clip.SourceRange().Duration()
+		}
+
+		// Angles can't begin before the multicam does
+		offset := addTime(start, metadataTime(multicam, "source_offset"))
+		if offset.ToSeconds() < 0 {
+			start = subTime(start, offset)
+			duration = addTime(duration, offset)
+			offset = opentime.NewRationalTime(0, offset.Rate())
+		}
+		angle.Items = append(angle.Items, &Clip{
+			XMLName:  xml.Name{Local: "asset-clip"},
+			Name:     asset.Name,
+			Ref:      asset.ID,
+			Offset:   e.formatRationalTime(offset),
+			Start:    e.formatRationalTime(start),
+			Duration: e.formatRationalTime(duration),
+		})
+	}
+
+	return media
+}
+
+// convertTimeMap builds a FCPX timeMap from an item's time effects. The
+// first LinearTimeWarp or FreezeFrame found becomes a two point map over the
+// item's source range. Items without one fall back to a variable speed ramp
+// recorded in metadata by the Decoder.
+func (e *Encoder) convertTimeMap(effects []gotio.Effect, metadata map[string]interface{}, start, duration opentime.RationalTime) *TimeMap {
+	for _, effect := range effects {
+		var scalar float64
+		switch v := effect.(type) {
+		case *gotio.FreezeFrame:
+			scalar = 0
+		case *gotio.LinearTimeWarp:
+			scalar = v.TimeScalar()
+		default:
+			continue
+		}
+
+		timeMap := &TimeMap{}
+		timeMap.FrameSampling, _ = effect.Metadata()["fcpx_frame_sampling"].(string)
+		timeMap.PreservesPitch, _ = effect.Metadata()["fcpx_preserves_pitch"].(string)
+
+		// The clip's own time runs from its start, and source time from
+		// the same point at the warped speed
+		end := addTime(start, duration)
+		mappedEnd := addTime(start, opentime.NewRationalTime(duration.Value()*scalar, duration.Rate()))
+		timeMap.TimePoints = []*TimePoint{
+			{Time: e.formatRationalTime(start), Value: e.formatRationalTime(start)},
+			{Time: e.formatRationalTime(end), Value: e.formatRationalTime(mappedEnd)},
+		}
+		return timeMap
+	}
+
+	ramp, ok := metadata["fcpx_time_map"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	timeMap := &TimeMap{}
+	timeMap.FrameSampling, _ = ramp["frame_sampling"].(string)
+	timeMap.PreservesPitch, _ = ramp["preserves_pitch"].(string)
+	points, _ := ramp["points"].([]interface{})
+	for _, value := range points {
+		point, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p := &TimePoint{}
+		p.Time, _ = point["time"].(string)
+		p.Value, _ = point["value"].(string)
+		p.Interp, _ = point["interp"].(string)
+		p.InTime, _ = point["in_time"].(string)
+		p.OutTime, _ = point["out_time"].(string)
+		timeMap.TimePoints = append(timeMap.TimePoints, p)
+	}
+
+	return timeMap
+}
+
+// convertConformRate restores a conform-rate recorded in metadata by the
+// Decoder.
+func (e *Encoder) convertConformRate(metadata map[string]interface{}) *ConformRate {
+	conform, ok := metadata["fcpx_conform_rate"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	conformRate := &ConformRate{}
+	conformRate.ScaleEnabled, _ = conform["scale_enabled"].(string)
+	conformRate.SrcFrameRate, _ = conform["src_frame_rate"].(string)
+	conformRate.FrameSampling, _ = conform["frame_sampling"].(string)
+	return conformRate
+}
+
+// formatRationalTime converts an OTIO RationalTime to FCPX rational time
+// format. As in files written by Final Cut, whole seconds are written as
+// such and whole frames in the timebase of the sequence's frame duration.
 func (e *Encoder) formatRationalTime(rt opentime.RationalTime) string {
-	if rt.Rate() <= 0 {
-		return "0/1s"
-	}
-	// FCPX format: value/rate + "s"
-	// Round value to avoid floating point precision issues
-	value := int64(rt.Value())
-	rate := int64(rt.Rate())
-	return fmt.Sprintf("%d/%ds", value, rate)
+	return e.formatTime(e.time(rt))
+}
+
+// time converts an OTIO RationalTime to an exact time. A float only
+// approximates most times, so they are snapped to the sequence's timebase,
+// the denominator of its frame duration, or else to audio samples; times on
+// neither are matched to the nearest simple fraction.
+func (e *Encoder) time(rt opentime.RationalTime) Time {
+	if _, den := e.frameDuration.parts(); !e.frameDuration.IsZero() && den.IsInt64() {
+		if t, ok := snapTime(rt, den.Int64(), timeTolerance); ok {
+			return t
+		}
+	}
+	if t, ok := snapTime(rt, audioTimebase, timeTolerance); ok {
+		return t
+	}
+	return TimeFromRationalTime(rt)
+}
+
+// formatTime formats an exact time as formatRationalTime does.
+func (e *Encoder) formatTime(t Time) string {
+	if t.Rat().IsInt() {
+		return t.Rat().Num().String() + "s"
+	}
+	if !e.frameDuration.IsZero() {
+		if conformed := t.Conform(e.frameDuration); conformed.Cmp(t) == 0 {
+			return conformed.String()
+		}
+	}
+	return t.String()
+}
+
+// metadataTime reads an FCPX time string written to metadata by the Decoder.
+// Missing or invalid times are zero.
+func metadataTime(metadata map[string]interface{}, key string) opentime.RationalTime {
+	value, _ := metadata[key].(string)
+	t, err := ParseTime(value)
+	if err != nil {
+		return opentime.NewRationalTime(0, 1)
+	}
+	return t.RationalTime()
 }
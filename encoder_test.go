@@ -0,0 +1,998 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcpxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Avalanche-io/gotio"
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// newTestClip creates a clip with the given source range in frames at 24 fps.
+func newTestClip(name string, start, duration float64) *gotio.Clip {
+	sourceRange := opentime.NewTimeRange(
+		opentime.NewRationalTime(start, 24),
+		opentime.NewRationalTime(duration, 24),
+	)
+	ref := gotio.NewExternalReference("", "", nil, nil)
+	return gotio.NewClip(name, ref, &sourceRange, nil, nil, nil, "", nil)
+}
+
+// newMediaClip creates a clip of 100s of media at url, with the given source
+// range in frames at 24 fps.
+func newMediaClip(name, url string, start, duration float64) *gotio.Clip {
+	availableRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(2400, 24))
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(start, 24), opentime.NewRationalTime(duration, 24))
+	ref := gotio.NewExternalReference(name, url, &availableRange, nil)
+	return gotio.NewClip(name, ref, &sourceRange, nil, nil, nil, "", nil)
+}
+
+// newTestGap creates a gap of duration frames at 24 fps.
+func newTestGap(duration float64) *gotio.Gap {
+	gapRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(duration, 24))
+	return gotio.NewGap("", &gapRange, nil, nil, nil, nil)
+}
+
+func TestEncoder_Transition(t *testing.T) {
+	timeline := gotio.NewTimeline("Transition Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(newTestClip("Clip 1", 0, 48))
+	videoTrack.AppendChild(gotio.NewTransition("Dissolve", gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(12, 24), opentime.NewRationalTime(12, 24), nil))
+	videoTrack.AppendChild(newTestClip("Clip 2", 0, 48))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, `<transition name="Dissolve" offset="36/24s" duration="1s">`) {
+		t.Errorf("Expected a 1s transition in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<filter-video ref="r2" name="Cross Dissolve">`) {
+		t.Errorf("Expected a cross dissolve filter in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<effect id="r2" name="Cross Dissolve" uid="`+crossDissolveUID+`">`) {
+		t.Errorf("Expected a cross dissolve effect resource in output, got:\n%s", output)
+	}
+}
+
+func TestEncoder_LeadingTransition(t *testing.T) {
+	timeline := gotio.NewTimeline("Leading Transition Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(gotio.NewTransition("Fade In", gotio.TransitionTypeSMPTEDissolve,
+		opentime.NewRationalTime(12, 24), opentime.NewRationalTime(12, 24), nil))
+	videoTrack.AppendChild(newTestClip("Clip 1", 0, 48))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	// The part of the transition before the track's start is left out
+	output := buf.String()
+	if !strings.Contains(output, `<transition name="Fade In" offset="0s" duration="12/24s">`) {
+		t.Errorf("Expected the transition from the start of the spine, got:\n%s", output)
+	}
+	if strings.Contains(output, `offset="-`) {
+		t.Errorf("Expected no negative offsets, got:\n%s", output)
+	}
+}
+
+func TestEncoder_Resources(t *testing.T) {
+	timeline := gotio.NewTimeline("Resources Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(newMediaClip("Shot A", "file:///media/A.mov", 0, 48))
+	videoTrack.AppendChild(newMediaClip("Shot A", "file:///media/A.mov", 96, 48))
+
+	// A compound clip of a third use of the same media
+	compoundTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	compoundTrack.AppendChild(newMediaClip("Shot A", "file:///media/A.mov", 240, 48))
+	compound := gotio.NewStack("Compound", nil, nil, nil, nil, nil)
+	compound.AppendChild(compoundTrack)
+	videoTrack.AppendChild(compound)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	if count := strings.Count(output, "<asset "); count != 1 {
+		t.Errorf("Expected 1 asset for the shared media, got %d:\n%s", count, output)
+	}
+	for _, want := range []string{
+		`<format id="r1" frameDuration="1/24s">`,
+		`<asset id="r2" name="Shot A" start="0s" duration="100s" format="r1" hasVideo="1">`,
+		`<media-rep kind="original-media" src="file:///media/A.mov">`,
+		`<asset-clip name="Shot A" ref="r2" offset="2s" start="4s" duration="2s">`,
+		`<media id="r3" name="Compound">`,
+		`<asset-clip name="Shot A" ref="r2" offset="0s" start="10s" duration="2s">`,
+		`<ref-clip name="Compound" ref="r3"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+
+	// The output decodes back to the same media
+	decoded, err := NewDecoder(strings.NewReader(output)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode encoded output: %v", err)
+	}
+	clips := decoded.FindClips(nil, false)
+	if len(clips) != 3 {
+		t.Fatalf("Expected 3 decoded clips, got %d", len(clips))
+	}
+	for _, clip := range clips {
+		ref, ok := clip.MediaReference().(*gotio.ExternalReference)
+		if !ok || ref.TargetURL() != "file:///media/A.mov" {
+			t.Errorf("Expected clip %q to reference file:///media/A.mov, got %v", clip.Name(), clip.MediaReference())
+		}
+	}
+}
+
+func TestEncoder_Retiming(t *testing.T) {
+	timeline := gotio.NewTimeline("Retime Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(24, 24), opentime.NewRationalTime(48, 24))
+	warp := gotio.NewLinearTimeWarp("", "LinearTimeWarp", 2, nil)
+	fast := gotio.NewClip("Fast", gotio.NewExternalReference("", "", nil, nil), &sourceRange, nil,
+		[]gotio.Effect{warp}, nil, "", nil)
+	videoTrack.AppendChild(fast)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, `<timept time="1s" value="1s"></timept>`) {
+		t.Errorf("Expected a time point at the clip start, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<timept time="3s" value="5s"></timept>`) {
+		t.Errorf("Expected a double speed time point at the clip end, got:\n%s", output)
+	}
+}
+
+func TestEncoder_Multicam(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(multicamFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, `<mc-clip name="Interview" ref="r2" offset="0s" start="2s" duration="4s">`) {
+		t.Errorf("Expected the multicam clip use in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<mc-source angleID="A1" srcEnable="video"></mc-source>`) ||
+		!strings.Contains(output, `<mc-source angleID="B1" srcEnable="audio"></mc-source>`) {
+		t.Errorf("Expected video and audio angle sources in output, got:\n%s", output)
+	}
+}
+
+func TestEncoder_SyncClip(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(syncClipFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, `<sync-clip name="Take 1" offset="0s" start="1s" duration="4s">`) {
+		t.Errorf("Expected the sync-clip in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<audio name="Recorder" ref="r3" lane="-1" offset="1s" start="21s" duration="4s">`) {
+		t.Errorf("Expected the synced recorder audio in output, got:\n%s", output)
+	}
+	if !strings.Contains(output, `<audio-role-source role="dialogue.dialogue-1" active="0">`) {
+		t.Errorf("Expected the sync sources in output, got:\n%s", output)
+	}
+}
+
+// timeAttributes returns the offset, start and duration attributes of every
+// element of an FCPX document, in document order.
+func timeAttributes(t *testing.T, data []byte) []string {
+	var times []string
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return times
+		}
+		if err != nil {
+			t.Fatalf("Failed to read FCPX XML: %v", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			for _, attr := range start.Attr {
+				switch attr.Name.Local {
+				case "offset", "start", "duration":
+					times = append(times, attr.Value)
+				}
+			}
+		}
+	}
+}
+
+func TestEncoder_ExampleTimesRoundTrip(t *testing.T) {
+	data, err := os.ReadFile("testdata/fcpx_example.fcpxml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	timeline, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode test file: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+	output := buf.String()
+
+	// Every time written is exact: in a timebase the source file uses,
+	// rather than one recovered from a float
+	var timebases []*big.Int
+	for _, value := range timeAttributes(t, data) {
+		time, err := ParseTime(value)
+		if err != nil {
+			t.Fatalf("Failed to parse source time %q: %v", value, err)
+		}
+		timebases = append(timebases, time.Rat().Denom())
+	}
+	for _, value := range timeAttributes(t, buf.Bytes()) {
+		time, err := ParseTime(value)
+		if err != nil {
+			t.Errorf("Failed to parse written time %q: %v", value, err)
+			continue
+		}
+		exact := false
+		for _, timebase := range timebases {
+			if new(big.Int).Rem(timebase, time.Rat().Denom()).Sign() == 0 {
+				exact = true
+				break
+			}
+		}
+		if !exact {
+			t.Errorf("Expected %q in a timebase of the source file", value)
+		}
+	}
+
+	// The audio connected 5621/144000s into the gap of compound_clip_1
+	want := `<asset-clip name="IMG_0268" ref="r3" lane="-1" offset="5621/144000s" start="0s" duration="10s"`
+	if !strings.Contains(output, want) {
+		t.Errorf("Expected %s in output, got:\n%s", want, output)
+	}
+}
+
+func TestEncoder_NTSCRoundTrip(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<project name="NTSC Test">
+		<sequence format="r1">
+			<spine>
+				<video name="Shot 1" start="518405621/144000s" duration="1001/30000s"/>
+				<video name="Shot 2" start="1001/30000s" duration="5005/30000s"/>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	timeline, err := NewDecoder(strings.NewReader(fcpxmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		`<video name="Shot 1" offset="0s" start="518405621/144000s" duration="1001/30000s">`,
+		`<video name="Shot 2" offset="1001/30000s" start="1001/30000s" duration="5005/30000s">`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_NTSCFormatRoundTrip(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" name="FFVideoFormat1080p2997" frameDuration="1001/30000s" width="1920" height="1080"/>
+		<asset id="r2" name="Interview" src="file:///media/interview.mov" start="0s" duration="600600/30000s" hasVideo="1" format="r1"/>
+	</resources>
+	<project name="NTSC">
+		<sequence format="r1" duration="36036/30000s" tcStart="3600s" tcFormat="NDF">
+			<spine>
+				<asset-clip name="Shot 1" ref="r2" offset="3600s" start="1001/30000s" duration="5005/30000s"/>
+				<asset-clip name="Shot 2" ref="r2" offset="108005005/30000s" start="518405621/144000s" duration="1001/30000s"/>
+				<asset-clip name="Shot 3" ref="r2" offset="108006006/30000s" start="108108/30000s" duration="30030/30000s">
+					<timeMap>
+						<timept time="108108/30000s" value="108108/30000s"/>
+						<timept time="138138/30000s" value="168168/30000s"/>
+					</timeMap>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	timeline, err := NewDecoder(strings.NewReader(fcpxmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	// Every time in the sequence is written back exactly as it was read
+	output := buf.String()
+	for _, want := range []string{
+		`<sequence format="r1" duration="36036/30000s" tcStart="3600s" tcFormat="NDF">`,
+		`<asset-clip name="Shot 1" ref="r2" offset="3600s" start="1001/30000s" duration="5005/30000s"></asset-clip>`,
+		`<asset-clip name="Shot 2" ref="r2" offset="108005005/30000s" start="518405621/144000s" duration="1001/30000s"></asset-clip>`,
+		`<asset-clip name="Shot 3" ref="r2" offset="108006006/30000s" start="108108/30000s" duration="30030/30000s">`,
+		`<timept time="108108/30000s" value="108108/30000s"></timept>`,
+		`<timept time="138138/30000s" value="168168/30000s"></timept>`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_SequenceSettings(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(ntscSequenceFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		`<format id="r1" name="FFVideoFormat1080p2997" frameDuration="1001/30000s" width="1920" height="1080" colorSpace="1-1-1 (Rec. 709)">`,
+		`<sequence format="r1" duration="30030/30000s" tcStart="3600s" tcFormat="DF" audioLayout="stereo" audioRate="48k">`,
+		`duration="30030/30000s"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_Options(t *testing.T) {
+	availableRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(240, 24))
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(48, 24))
+	ref := gotio.NewExternalReference("Shot", "file:///media/Shot.mov", &availableRange, nil)
+
+	timeline := gotio.NewTimeline("Options Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(gotio.NewClip("Shot", ref, &sourceRange, nil, nil, nil, "", nil))
+	timeline.Tracks().AppendChild(videoTrack)
+
+	tests := []struct {
+		name    string
+		opts    EncoderOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults",
+			want:    []string{`<fcpxml version="1.9">`, `<media-rep kind="original-media" src="file:///media/Shot.mov">`, "\n  <project "},
+			notWant: []string{"<library", "<event"},
+		},
+		{
+			name:    "version 1.8",
+			opts:    EncoderOptions{Version: "1.8"},
+			want:    []string{`<fcpxml version="1.8">`, `src="file:///media/Shot.mov"`},
+			notWant: []string{"<media-rep"},
+		},
+		{
+			name:    "version 1.9",
+			opts:    EncoderOptions{Version: "1.9"},
+			want:    []string{`<fcpxml version="1.9">`, `<media-rep kind="original-media" src="file:///media/Shot.mov">`},
+			notWant: []string{`<asset id="r2" name="Shot" src=`},
+		},
+		{
+			name:    "version 1.10",
+			opts:    EncoderOptions{Version: "1.10"},
+			want:    []string{`<fcpxml version="1.10">`, `<media-rep kind="original-media" src="file:///media/Shot.mov">`},
+			notWant: []string{`<asset id="r2" name="Shot" src=`},
+		},
+		{
+			name:    "version 1.11",
+			opts:    EncoderOptions{Version: "1.11"},
+			want:    []string{`<fcpxml version="1.11">`, `<media-rep kind="original-media" src="file:///media/Shot.mov">`},
+			notWant: []string{`<asset id="r2" name="Shot" src=`},
+		},
+		{
+			name: "library",
+			opts: EncoderOptions{Version: "1.11", Library: true, LibraryLocation: "file:///Volumes/Media/Edit.fcpbundle/", EventName: "Dailies"},
+			want: []string{
+				`<fcpxml version="1.11">`,
+				`<library location="file:///Volumes/Media/Edit.fcpbundle/">`,
+				`<event name="Dailies">`,
+				`<project name="Options Test">`,
+			},
+		},
+		{
+			name: "library without an event name",
+			opts: EncoderOptions{Library: true},
+			want: []string{`<library>`, `<event name="Options Test">`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf)
+			encoder.SetOptions(tt.opts)
+			if err := encoder.Encode(timeline); err != nil {
+				t.Fatalf("Failed to encode timeline: %v", err)
+			}
+
+			output := buf.String()
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("Expected %s in output, got:\n%s", want, output)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(output, notWant) {
+					t.Errorf("Expected no %s in output, got:\n%s", notWant, output)
+				}
+			}
+
+			// Each version decodes back to the clip's media
+			decoded, err := NewDecoder(strings.NewReader(output)).Decode()
+			if err != nil {
+				t.Fatalf("Failed to decode encoded output: %v", err)
+			}
+			clips := decoded.FindClips(nil, false)
+			if len(clips) != 1 {
+				t.Fatalf("Expected 1 decoded clip, got %d", len(clips))
+			}
+			if ref, ok := clips[0].MediaReference().(*gotio.ExternalReference); !ok || ref.TargetURL() != "file:///media/Shot.mov" {
+				t.Errorf("Expected the clip to reference file:///media/Shot.mov, got %v", clips[0].MediaReference())
+			}
+		})
+	}
+
+	for _, version := range []string{"1.7", "2", "one.nine", "1.12", "1.50", "1.999", "1.09"} {
+		encoder := NewEncoder(&bytes.Buffer{})
+		encoder.SetOptions(EncoderOptions{Version: version})
+		if err := encoder.Encode(timeline); err == nil {
+			t.Errorf("Expected an error encoding version %q", version)
+		}
+	}
+}
+
+func TestEncoder_Lanes(t *testing.T) {
+	timeline := gotio.NewTimeline("Lanes Test", nil, nil)
+
+	// The primary storyline
+	video1 := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	video1.AppendChild(newMediaClip("A", "file:///media/A.mov", 240, 48))
+	video1.AppendChild(newMediaClip("B", "file:///media/B.mov", 0, 48))
+
+	// A clip over A, then two adjacent clips starting over B that run past
+	// the end of the spine
+	video2 := gotio.NewTrack("Video 2", nil, gotio.TrackKindVideo, nil, nil)
+	video2.AppendChild(newTestGap(24))
+	video2.AppendChild(newMediaClip("C", "file:///media/C.mov", 0, 24))
+	video2.AppendChild(newTestGap(12))
+	video2.AppendChild(newMediaClip("D", "file:///media/D.mov", 0, 24))
+	video2.AppendChild(newMediaClip("E", "file:///media/E.mov", 0, 36))
+
+	// A's own audio, and music below it
+	audio1 := gotio.NewTrack("Audio 1", nil, gotio.TrackKindAudio, nil, nil)
+	audio1.AppendChild(newMediaClip("A", "file:///media/A.mov", 240, 48))
+	audio2 := gotio.NewTrack("Audio 2", nil, gotio.TrackKindAudio, nil, nil)
+	audio2.AppendChild(newTestGap(12))
+	audio2.AppendChild(newMediaClip("Music", "file:///media/Music.wav", 0, 72))
+
+	for _, track := range []*gotio.Track{video1, video2, audio1, audio2} {
+		timeline.Tracks().AppendChild(track)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		`<asset-clip name="A" ref="r2" offset="0s" start="10s" duration="2s">`,
+		`<asset-clip name="C" ref="r4" lane="1" offset="11s" start="0s" duration="1s">`,
+		`<asset-clip name="Music" ref="r7" lane="-1" offset="252/24s" start="0s" duration="3s" srcEnable="audio">`,
+		`<spine lane="1" offset="12/24s">`,
+		`<gap name="Gap" offset="4s" duration="1s">`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, `name="A" ref="r2" lane="-1"`) {
+		t.Errorf("Expected A's audio to be written by its asset-clip, got:\n%s", output)
+	}
+
+	// The output decodes back to the same tracks
+	decoded, err := NewDecoder(strings.NewReader(output)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode encoded output: %v", err)
+	}
+	videoTracks := decoded.VideoTracks()
+	if len(videoTracks) != 2 {
+		t.Fatalf("Expected 2 video tracks, got %d", len(videoTracks))
+	}
+
+	var names []string
+	for _, child := range videoTracks[1].Children() {
+		switch v := child.(type) {
+		case *gotio.Clip:
+			names = append(names, v.Name())
+		case *gotio.Stack:
+			for _, track := range v.Children() {
+				for _, clip := range track.(*gotio.Track).Children() {
+					if clip, ok := clip.(*gotio.Clip); ok && track.(*gotio.Track).Kind() == gotio.TrackKindVideo {
+						names = append(names, clip.Name())
+					}
+				}
+			}
+		}
+	}
+	if strings.Join(names, ",") != "C,D,E" {
+		t.Errorf("Expected C, D and E on the second video track, got %v", names)
+	}
+
+	found := false
+	for _, track := range decoded.AudioTracks() {
+		items, err := NewEncoder(nil).trackItems(track)
+		if err != nil {
+			t.Fatalf("Failed to get audio track items: %v", err)
+		}
+		for _, ti := range items {
+			if clip, ok := ti.item.(*gotio.Clip); ok && clip.Name() == "Music" {
+				found = true
+				if ti.start.Seconds() != 0.5 {
+					t.Errorf("Expected the music at 0.5s, got %gs", ti.start.Seconds())
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected the music on an audio track")
+	}
+}
+
+func TestEncoder_Offsets(t *testing.T) {
+	// A thousand single frames at 29.97 fps, where summing float seconds
+	// would drift off the frame grid
+	timeline := gotio.NewTimeline("Offsets Test", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	for i := 0; i < 1000; i++ {
+		sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 30000.0/1001), opentime.NewRationalTime(1, 30000.0/1001))
+		clip := gotio.NewClip("Frame", gotio.NewExternalReference("", "", nil, nil), &sourceRange, nil, nil, nil, "", nil)
+		videoTrack.AppendChild(clip)
+	}
+	timeline.Tracks().AppendChild(videoTrack)
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		`<sequence format="r1" duration="1001000/30000s">`,
+		`<video name="Frame" offset="0s" start="0s" duration="1001/30000s">`,
+		`<video name="Frame" offset="999999/30000s" start="0s" duration="1001/30000s">`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output", want)
+		}
+	}
+}
+
+func TestEncoder_MarkerKinds(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(markerKindsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<marker start="1s" duration="1/24s" value="Standard"></marker>`,
+		`<marker start="2s" duration="1/24s" value="Fix color" note="Too warm" completed="0"></marker>`,
+		`<marker start="3s" duration="1/24s" value="Fix audio" completed="1"></marker>`,
+		`<chapter-marker start="4s" duration="1/24s" value="Act Two" posterOffset="12/24s"></chapter-marker>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_KeywordsAndRatings(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(keywordsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<keyword start="10s" duration="20s" value="snow, truck"></keyword>`,
+		`<keyword start="15s" duration="5s" value="tree" note="wide"></keyword>`,
+		`<rating name="Best take" start="12s" duration="4s" value="favorite"></rating>`,
+		`<rating start="25s" duration="2s" value="reject"></rating>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "<marker") {
+		t.Errorf("Expected no markers in output, got:\n%s", output)
+	}
+
+	// Blue markers from other tools are written as keywords
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(48, 24))
+	selectRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	selected := gotio.NewMarker("select", selectRange, gotio.MarkerColorBlue, "", nil)
+	clip := gotio.NewClip("Logged", gotio.NewExternalReference("", "", nil, nil), &sourceRange, nil, nil,
+		[]*gotio.Marker{selected}, "", nil)
+	timeline = gotio.NewTimeline("Logged", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+	if !strings.Contains(buf.String(), `<keyword start="0s" duration="1s" value="select"></keyword>`) {
+		t.Errorf("Expected the blue marker as a keyword, got:\n%s", buf.String())
+	}
+}
+
+func TestEncoder_NotesAndMetadata(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(notesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<note>Picture lock v2</note>`,
+		`<md key="com.apple.proapps.studio.reel" value="5"></md>`,
+		`<note>Truck in snow</note>`,
+		`<md key="com.apple.proapps.studio.scene" value="17"></md>`,
+		`<md key="com.apple.proapps.studio.shot" value="3"></md>`,
+		`<md key="com.apple.proapps.spotlight.kMDItemCodecs">`,
+		`<string>H.264</string>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_ClipNotesAndMetadata(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(clipNotesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<note>Compound note</note>`,
+		`<note>Multicam note</note>`,
+		`<note>Sync note</note>`,
+		`<md key="com.apple.proapps.studio.scene" value="1"></md>`,
+		`<md key="com.apple.proapps.studio.scene" value="2"></md>`,
+		`<md key="com.apple.proapps.studio.scene" value="3"></md>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_VideoRoles(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader(videoRolesFCPXML))
+	decoder.SetOptions(DecoderOptions{VideoTracks: GroupByRole})
+	timeline, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<asset-clip name="Interview" ref="r2" offset="0s" start="0s" duration="10s" videoRole="video.video-1">`,
+		`<asset-clip name="Logo" ref="r4" lane="2" offset="2s" start="0s" duration="2s" videoRole="graphics"></asset-clip>`,
+		`<asset-clip name="Lower Third" ref="r3" lane="1" offset="5s" start="0s" duration="3s" videoRole="titles.titles-1"></asset-clip>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_TitlesAndGenerators(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(titlesFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<effect id="r2" name="Custom" uid=".../Generators.localized/Solids.localized/Custom.localized/Custom.motn"></effect>`,
+		`<effect id="r3" name="Basic Title" uid=".../Titles.localized/Bumper:Opener.localized/Basic Title.localized/Basic Title.moti"></effect>`,
+		`<video name="Backdrop" ref="r2" offset="0s" start="3600s" duration="5s">`,
+		`<param name="Color" key="9999/10003/13260/3296672360/2/314/315" value="0 0 1"></param>`,
+		`<title name="Opening" ref="r3" lane="1" offset="3601s" start="3600s" duration="3s" role="titles.titles-1">`,
+		`<text-style ref="ts2">World&#xA;</text-style>`,
+		`<text-style ref="ts3">Second line</text-style>`,
+		`<text-style font="Helvetica" fontSize="63" bold="1"></text-style>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+
+	// Generators from other tools have no effect uid: titles use the Basic
+	// Title, and other generators become gaps
+	clipRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(48, 24))
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(gotio.NewClip("Bars", gotio.NewGeneratorReference("Bars", "SMPTEBars", nil, nil, nil),
+		&clipRange, nil, nil, nil, "", nil))
+	videoTrack.AppendChild(gotio.NewClip("Slate", gotio.NewGeneratorReference("Slate", "Text", nil,
+		map[string]interface{}{"text": "Scene 1"}, nil), &clipRange, nil, nil, nil, "", nil))
+	timeline = gotio.NewTimeline("Generated", nil, nil)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	buf.Reset()
+	encoder := NewEncoder(&buf)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+	output = buf.String()
+	expected = []string{
+		`<effect id="r2" name="Basic Title" uid="` + basicTitleUID + `"></effect>`,
+		`<gap name="Bars" offset="0s" duration="2s"></gap>`,
+		`<title name="Slate" ref="r2" offset="2s" start="0s" duration="2s">`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "<effect ") != 1 {
+		t.Errorf("Expected only the Basic Title effect, got:\n%s", output)
+	}
+	if warnings := encoder.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "Bars") {
+		t.Errorf("Expected a warning for the generator written as a gap, got %v", warnings)
+	}
+}
+
+func TestEncoder_Captions(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(captionsFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<caption name="Hi" lane="1" offset="1s" start="3600s" duration="2s" role="CEA-608?captionFormat=608.en">`,
+		`<text display-style="pop-on" position="0 85" alignment="center">`,
+		`<caption name="Hello" lane="2" offset="1s" start="3600s" duration="2s" role="iTT?captionFormat=ITT.en">`,
+		`<text placement="bottom">`,
+		`<text-style font=".AppleSystemUIFont" fontSize="13" fontColor="1 1 1 1" backgroundColor="0 0 0 1"></text-style>`,
+		`<caption name="Goodbye" lane="2" offset="11s" start="3600s" duration="3s" role="iTT?captionFormat=ITT.en">`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "<effect") {
+		t.Errorf("Expected captions to use no effect, got:\n%s", output)
+	}
+
+	// Captions from other tools take their role from their format, and
+	// their track never becomes the spine
+	parameters := map[string]interface{}{"caption_format": "SRT.en", "text": "Hi there"}
+	generator := gotio.NewGeneratorReference("Caption", "Caption", nil, parameters,
+		map[string]interface{}{"fcpx_element": "caption"})
+	captionRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(24, 24))
+	captionTrack := gotio.NewTrack("Subtitles", nil, gotio.TrackKindVideo, nil, nil)
+	captionTrack.AppendChild(gotio.NewClip("Line 1", generator, &captionRange, nil, nil, nil, "", nil))
+
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(48, 24))
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(gotio.NewClip("Shot", gotio.NewExternalReference("", "", nil, nil), &sourceRange, nil, nil, nil, "", nil))
+
+	timeline = gotio.NewTimeline("Subtitled", nil, nil)
+	timeline.Tracks().AppendChild(captionTrack)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+	output = buf.String()
+	expected = []string{
+		`<video name="Shot" offset="0s" start="0s" duration="2s">`,
+		`<caption name="Line 1" lane="1" offset="0s" start="0s" duration="1s" role="SRT?captionFormat=SRT.en">`,
+		`<text-style>Hi there</text-style>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestEncoder_ClipFilters(t *testing.T) {
+	timeline, err := NewDecoder(strings.NewReader(filtersFCPXML)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	output := buf.String()
+	expected := []string{
+		`<effect id="r3" name="Color Board" uid="FFColorBoardEffect"></effect>`,
+		`<filter-video ref="r3" name="Color Board">`,
+		`<param name="Master" key="1/1" value="0.1 0.2 0.3"></param>`,
+		`<keyframe time="3s" value="1" interp="linear" curve="smooth"></keyframe>`,
+		`<filter-video ref="r4" name="Gaussian Blur" enabled="0">`,
+		`<filter-audio ref="r5" name="Channel EQ"></filter-audio>`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected %s in output, got:\n%s", want, output)
+		}
+	}
+
+	// Effects from other tools have no effect uid, so they are dropped
+	sourceRange := opentime.NewTimeRange(opentime.NewRationalTime(0, 24), opentime.NewRationalTime(48, 24))
+	clip := gotio.NewClip("Shot", gotio.NewExternalReference("", "", nil, nil), &sourceRange, nil,
+		[]gotio.Effect{gotio.NewEffect("Glow", "Bloom", nil)}, nil, "", nil)
+	timeline = gotio.NewTimeline("Graded", nil, nil)
+	videoTrack := gotio.NewTrack("Video 1", nil, gotio.TrackKindVideo, nil, nil)
+	videoTrack.AppendChild(clip)
+	timeline.Tracks().AppendChild(videoTrack)
+
+	buf.Reset()
+	encoder := NewEncoder(&buf)
+	if err := encoder.Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+	output = buf.String()
+	if strings.Contains(output, "<effect") || strings.Contains(output, "<filter-video") {
+		t.Errorf("Expected no effect or filter in output, got:\n%s", output)
+	}
+	if warnings := encoder.Warnings(); len(warnings) != 1 || !strings.Contains(warnings[0], "Glow") {
+		t.Errorf("Expected a warning for the dropped effect, got %v", warnings)
+	}
+}
+
+func TestEncoder_ConnectedClipsBeforeMarkers(t *testing.T) {
+	fcpxmlData := `<?xml version="1.0" encoding="UTF-8"?>
+<fcpxml version="1.9">
+	<resources>
+		<format id="r1" frameDuration="1/24s"/>
+		<asset id="r2" name="Main" src="file:///media/main.mov" start="0s" duration="20s" hasVideo="1"/>
+		<asset id="r3" name="Insert" src="file:///media/insert.mov" start="0s" duration="20s" hasVideo="1"/>
+	</resources>
+	<project name="Order">
+		<sequence format="r1">
+			<spine>
+				<asset-clip name="Main" ref="r2" offset="0s" start="0s" duration="10s">
+					<marker start="2s" duration="1/24s" value="Look"/>
+					<asset-clip name="Insert" ref="r3" lane="1" offset="4s" start="0s" duration="2s"/>
+				</asset-clip>
+			</spine>
+		</sequence>
+	</project>
+</fcpxml>`
+
+	timeline, err := NewDecoder(strings.NewReader(fcpxmlData)).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode FCPX XML: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(timeline); err != nil {
+		t.Fatalf("Failed to encode timeline: %v", err)
+	}
+
+	// Anchored items come before marker items, as the DTD requires
+	output := buf.String()
+	insert := strings.Index(output, `<asset-clip name="Insert"`)
+	marker := strings.Index(output, `<marker start="2s"`)
+	if insert < 0 || marker < 0 {
+		t.Fatalf("Expected the connected clip and the marker in output, got:\n%s", output)
+	}
+	if insert > marker {
+		t.Errorf("Expected the connected clip before the marker, got:\n%s", output)
+	}
+}
@@ -4,8 +4,11 @@
 package fcpxml
 
 import (
+	"encoding/xml"
 	"os"
 	"testing"
+
+	"github.com/Avalanche-io/gotio"
 )
 
 // TestDecoder_CompoundClips tests reading files with compound clips (ref-clip elements).
@@ -21,14 +24,62 @@ func TestDecoder_CompoundClips(t *testing.T) {
 
 // TestDecoder_Transitions tests reading files with transitions.
 func TestDecoder_Transitions(t *testing.T) {
-	data, err := os.ReadFile("testdata/fcpx_example.fcpxml")
+	file, err := os.Open("testdata/fcpx_example.fcpxml")
 	if err != nil {
-		t.Fatalf("Failed to read test file: %v", err)
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	timeline, err := NewDecoder(file).Decode()
+	if err != nil {
+		t.Fatalf("Failed to decode test file: %v", err)
+	}
+
+	// The primary storyline has one cross dissolve, the secondary
+	// storyline on lane 1 has two
+	var spineTransitions, storylineTransitions []*gotio.Transition
+	for _, track := range timeline.VideoTracks() {
+		for _, child := range track.Children() {
+			switch v := child.(type) {
+			case *gotio.Transition:
+				spineTransitions = append(spineTransitions, v)
+			case *gotio.Stack:
+				for _, nested := range v.Children() {
+					nestedTrack, ok := nested.(*gotio.Track)
+					if !ok {
+						continue
+					}
+					for _, item := range nestedTrack.Children() {
+						if transition, ok := item.(*gotio.Transition); ok {
+							storylineTransitions = append(storylineTransitions, transition)
+						}
+					}
+				}
+			}
+		}
 	}
 
-	// The example file contains transitions
-	// Verify file can be read without errors
-	t.Logf("Successfully read FCPXML with transitions: %d bytes", len(data))
+	if len(spineTransitions) != 1 {
+		t.Fatalf("Expected 1 transition in the primary storyline, got %d", len(spineTransitions))
+	}
+	if len(storylineTransitions) != 2 {
+		t.Errorf("Expected 2 transitions in the secondary storyline, got %d", len(storylineTransitions))
+	}
+
+	transition := spineTransitions[0]
+	if transition.TransitionType() != gotio.TransitionTypeSMPTEDissolve {
+		t.Errorf("Expected SMPTE_Dissolve, got %s", transition.TransitionType())
+	}
+	filter, ok := transition.Metadata()["fcpx_filter_video"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected fcpx_filter_video metadata on transition")
+	}
+	if filter["effect_uid"] != "FxPlug:4731E73A-8DAC-4113-9A30-AE85B1761265" {
+		t.Errorf("Expected effect uid to be resolved, got %v", filter["effect_uid"])
+	}
+	if params, _ := filter["params"].([]interface{}); len(params) != 4 {
+		t.Errorf("Expected 4 params, got %d", len(params))
+	}
 }
 
 // TestDecoder_KeywordsAndMetadata tests reading files with keywords and metadata.
@@ -108,6 +159,56 @@ func TestTypes_RefClip(t *testing.T) {
 	}
 }
 
+// TestTypes_ClipName tests that a Clip is written as an asset-clip unless
+// its XMLName says otherwise.
+func TestTypes_ClipName(t *testing.T) {
+	output, err := xml.Marshal(&Clip{Name: "Shot", Ref: "r2"})
+	if err != nil {
+		t.Fatalf("Failed to marshal clip: %v", err)
+	}
+	if string(output) != `<asset-clip name="Shot" ref="r2"></asset-clip>` {
+		t.Errorf("Expected an asset-clip, got %s", output)
+	}
+
+	output, err = xml.Marshal(&Clip{XMLName: xml.Name{Local: "clip"}, Name: "Shot"})
+	if err != nil {
+		t.Fatalf("Failed to marshal clip: %v", err)
+	}
+	if string(output) != `<clip name="Shot"></clip>` {
+		t.Errorf("Expected a clip, got %s", output)
+	}
+}
+
+// TestTypes_MarkerCompleted tests that only to-do markers are written with
+// a completed attribute.
+func TestTypes_MarkerCompleted(t *testing.T) {
+	tests := []struct {
+		marker Marker
+		want   string
+	}{
+		{Marker{Value: "Note"}, `<marker value="Note"></marker>`},
+		{Marker{Value: "Fix", ToDo: true}, `<marker value="Fix" completed="0"></marker>`},
+		{Marker{Value: "Done", Completed: true}, `<marker value="Done" completed="1"></marker>`},
+	}
+	for _, tt := range tests {
+		output, err := xml.Marshal(&tt.marker)
+		if err != nil {
+			t.Fatalf("Failed to marshal marker: %v", err)
+		}
+		if string(output) != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, output)
+		}
+
+		var marker Marker
+		if err := xml.Unmarshal(output, &marker); err != nil {
+			t.Fatalf("Failed to unmarshal marker: %v", err)
+		}
+		if marker.Completed != tt.marker.Completed || marker.ToDo != (tt.marker.ToDo || tt.marker.Completed) {
+			t.Errorf("Expected %s to read back as written, got %+v", tt.want, marker)
+		}
+	}
+}
+
 // TestTypes_Keyword tests that Keyword type can be created.
 func TestTypes_Keyword(t *testing.T) {
 	keyword := &Keyword{
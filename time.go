@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcpxml
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+// Time is an exact FCPX time, a rational number of seconds such as
+// "1001/30000s". The numerator and denominator are kept as written rather
+// than reduced, so that times keep their timebase through a round trip.
+// Values too large for 64 bits fall back to big integers.
+type Time struct {
+	num, den int64
+
+	// bigNum and bigDen hold the value instead of num and den when it
+	// doesn't fit in them.
+	bigNum, bigDen *big.Int
+}
+
+// NewTime creates a Time of num/den seconds. A negative den moves its sign
+// to num, and a zero den panics, as it does for big.NewRat.
+func NewTime(num, den int64) Time {
+	if den == 0 {
+		panic("fcpxml: NewTime with zero denominator")
+	}
+	if den < 0 {
+		return newBigTime(big.NewInt(num), big.NewInt(den))
+	}
+	return Time{num: num, den: den}
+}
+
+// newBigTime creates a Time from big integers, using the 64 bit form when
+// they fit.
+func newBigTime(num, den *big.Int) Time {
+	if den.Sign() < 0 {
+		num = new(big.Int).Neg(num)
+		den = new(big.Int).Neg(den)
+	}
+	if num.IsInt64() && den.IsInt64() {
+		return Time{num: num.Int64(), den: den.Int64()}
+	}
+	return Time{bigNum: num, bigDen: den}
+}
+
+// ParseTime parses an FCPX time string such as "1001/30000s" or "10s".
+// Times without the "s" suffix are malformed.
+func ParseTime(s string) (Time, error) {
+	if !strings.HasSuffix(s, "s") {
+		return Time{}, fmt.Errorf("invalid rational time format: %s", s)
+	}
+	value := strings.TrimSuffix(s, "s")
+
+	numerator, denominator, isFraction := strings.Cut(value, "/")
+	num, ok := new(big.Int).SetString(numerator, 10)
+	if !ok {
+		return Time{}, fmt.Errorf("invalid rational time format: %s", s)
+	}
+
+	den := big.NewInt(1)
+	if isFraction {
+		den, ok = new(big.Int).SetString(denominator, 10)
+		if !ok || den.Sign() <= 0 {
+			return Time{}, fmt.Errorf("invalid rational time denominator: %s", denominator)
+		}
+	}
+
+	return newBigTime(num, den), nil
+}
+
+// TimeFromRationalTime converts an OTIO RationalTime to a Time. Whole frames
+// are in the timebase of the rate, so 1 frame at 30000/1001 fps is
+// "1001/30000s"; other values are reduced. Rates and values that are not
+// whole numbers are matched to the nearest simple fraction, as NTSC rates
+// are only approximated by a float64.
+func TimeFromRationalTime(rt opentime.RationalTime) Time {
+	if rt.Rate() <= 0 {
+		return Time{}
+	}
+
+	rateNum, rateDen := approximateRational(rt.Rate())
+	valueNum, valueDen := approximateRational(rt.Value())
+
+	// value frames of rateDen/rateNum seconds each
+	num := new(big.Int).Mul(valueNum, rateDen)
+	den := new(big.Int).Mul(valueDen, rateNum)
+	if valueDen.Cmp(big.NewInt(1)) == 0 {
+		return newBigTime(num, den)
+	}
+
+	// Times between frames have no timebase of their own and are reduced,
+	// which keeps whole seconds as "3600s"
+	r := new(big.Rat).SetFrac(num, den)
+	return newBigTime(r.Num(), r.Denom())
+}
+
+// snapTime returns rt as a whole number of 1/timebase seconds, when it is
+// within tolerance seconds of one.
+func snapTime(rt opentime.RationalTime, timebase int64, tolerance float64) (Time, bool) {
+	if rt.Rate() <= 0 || timebase <= 0 {
+		return Time{}, false
+	}
+	ticks := rt.Value() * float64(timebase) / rt.Rate()
+	n := math.Round(ticks)
+	if math.Abs(ticks-n) > tolerance*float64(timebase) || math.Abs(n) >= 1<<62 {
+		return Time{}, false
+	}
+	return Time{num: int64(n), den: timebase}, true
+}
+
+// approximateRational returns the simplest fraction within float64
+// precision of x, using its continued fraction expansion.
+func approximateRational(x float64) (*big.Int, *big.Int) {
+	if x == math.Trunc(x) && math.Abs(x) < 1<<62 {
+		return big.NewInt(int64(x)), big.NewInt(1)
+	}
+
+	tolerance := math.Abs(x)*1e-14 + 1e-12
+	// Convergents h/k of the continued fraction
+	h0, h1 := big.NewInt(0), big.NewInt(1)
+	k0, k1 := big.NewInt(1), big.NewInt(0)
+	rest := x
+	for i := 0; i < 64; i++ {
+		a := math.Floor(rest)
+		ai := new(big.Int)
+		new(big.Float).SetFloat64(a).Int(ai)
+
+		h0, h1 = h1, new(big.Int).Add(new(big.Int).Mul(ai, h1), h0)
+		k0, k1 = k1, new(big.Int).Add(new(big.Int).Mul(ai, k1), k0)
+
+		approx, _ := new(big.Rat).SetFrac(h1, k1).Float64()
+		if math.Abs(approx-x) <= tolerance || rest == a {
+			break
+		}
+		rest = 1 / (rest - a)
+	}
+
+	return h1, k1
+}
+
+// parts returns the numerator and denominator as big integers. The zero
+// Time is 0/1.
+func (t Time) parts() (*big.Int, *big.Int) {
+	if t.bigDen != nil {
+		return t.bigNum, t.bigDen
+	}
+	if t.den == 0 {
+		return big.NewInt(0), big.NewInt(1)
+	}
+	return big.NewInt(t.num), big.NewInt(t.den)
+}
+
+// Add returns t+u. Times in the same timebase keep it, and a time in a
+// timebase dividing the other's takes the other's. Others are added in the
+// least common multiple of their timebases and reduced, so that sums of
+// unrelated timebases don't grow without bound.
+func (t Time) Add(u Time) Time {
+	return t.combine(u, (*big.Int).Add)
+}
+
+// Sub returns t-u, in the timebase described for Add.
+func (t Time) Sub(u Time) Time {
+	return t.combine(u, (*big.Int).Sub)
+}
+
+// combine applies op to the numerators of t and u over a common denominator.
+func (t Time) combine(u Time, op func(z, x, y *big.Int) *big.Int) Time {
+	tn, td := t.parts()
+	un, ud := u.parts()
+	if td.Cmp(ud) == 0 {
+		return newBigTime(op(new(big.Int), tn, un), td)
+	}
+
+	gcd := new(big.Int).GCD(nil, nil, td, ud)
+	den := new(big.Int).Mul(td, new(big.Int).Quo(ud, gcd))
+	tn = new(big.Int).Mul(tn, new(big.Int).Quo(den, td))
+	un = new(big.Int).Mul(un, new(big.Int).Quo(den, ud))
+	num := op(new(big.Int), tn, un)
+	if den.Cmp(td) == 0 || den.Cmp(ud) == 0 {
+		return newBigTime(num, den)
+	}
+	r := new(big.Rat).SetFrac(num, den)
+	return newBigTime(r.Num(), r.Denom())
+}
+
+// scale returns t*num/den, for den non-zero.
+func (t Time) scale(num, den Time) Time {
+	r := new(big.Rat).Mul(t.Rat(), num.Rat())
+	r.Quo(r, den.Rat())
+	return newBigTime(r.Num(), r.Denom())
+}
+
+// Cmp compares t and u, returning -1, 0 or +1.
+func (t Time) Cmp(u Time) int {
+	return t.Rat().Cmp(u.Rat())
+}
+
+// Conform returns t rounded down to a whole number of frames of
+// frameDuration, in frameDuration's timebase. Times that are already on a
+// frame boundary only change timebase.
+func (t Time) Conform(frameDuration Time) Time {
+	tn, td := t.parts()
+	fn, fd := frameDuration.parts()
+	if fn.Sign() <= 0 {
+		return t
+	}
+
+	// frames = floor(t / frameDuration)
+	frames := new(big.Int).Mul(tn, fd)
+	divisor := new(big.Int).Mul(td, fn)
+	frames.Div(frames, divisor)
+
+	return newBigTime(frames.Mul(frames, fn), new(big.Int).Set(fd))
+}
+
+// IsZero reports whether t is zero seconds.
+func (t Time) IsZero() bool {
+	num, _ := t.parts()
+	return num.Sign() == 0
+}
+
+// Rat returns t as a big.Rat of seconds.
+func (t Time) Rat() *big.Rat {
+	num, den := t.parts()
+	return new(big.Rat).SetFrac(num, den)
+}
+
+// Seconds returns t in seconds as a float64.
+func (t Time) Seconds() float64 {
+	seconds, _ := t.Rat().Float64()
+	return seconds
+}
+
+// RationalTime converts t to an OTIO RationalTime in its own timebase, so
+// "1001/30000s" becomes 1001 at rate 30000.
+func (t Time) RationalTime() opentime.RationalTime {
+	num, den := t.parts()
+	value, _ := new(big.Float).SetInt(num).Float64()
+	rate, _ := new(big.Float).SetInt(den).Float64()
+	return opentime.NewRationalTime(value, rate)
+}
+
+// RationalTimeIn converts t to an OTIO RationalTime counting frames of
+// frameDuration, at the matching rate. "3600s" with a frame duration of
+// "1001/30000s" is 107892.1 frames at 29.97.
+func (t Time) RationalTimeIn(frameDuration Time) opentime.RationalTime {
+	value, _ := new(big.Rat).Quo(t.Rat(), frameDuration.Rat()).Float64()
+	rate, _ := new(big.Rat).Inv(frameDuration.Rat()).Float64()
+	return opentime.NewRationalTime(value, rate)
+}
+
+// String formats t as an FCPX time string: "0s", "10s" or "1001/30000s".
+func (t Time) String() string {
+	num, den := t.parts()
+	if num.Sign() == 0 {
+		return "0s"
+	}
+	if den.Cmp(big.NewInt(1)) == 0 {
+		return num.String() + "s"
+	}
+	return num.String() + "/" + den.String() + "s"
+}
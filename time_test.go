@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Contributors to the OpenTimelineIO project
+
+package fcpxml
+
+import (
+	"testing"
+
+	"github.com/Avalanche-io/gotio/opentime"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		seconds float64
+		wantErr bool
+	}{
+		{"1001/30000s", "1001/30000s", 1001.0 / 30000, false},
+		{"10900/3000s", "10900/3000s", 10900.0 / 3000, false},
+		{"518405621/144000s", "518405621/144000s", 518405621.0 / 144000, false},
+		{"10s", "10s", 10, false},
+		{"0s", "0s", 0, false},
+		{"123456789012345678901234567890/30000s", "123456789012345678901234567890/30000s", 123456789012345678901234567890.0 / 30000, false},
+		{"invalid", "", 0, true},
+		{"1/0s", "", 0, true},
+		{"10", "", 0, true},
+		{"1001/30000", "", 0, true},
+		{"s", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseTime(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTime(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if result.String() != tt.want {
+				t.Errorf("ParseTime(%q).String() = %q, want %q", tt.input, result.String(), tt.want)
+			}
+			if result.Seconds() != tt.seconds {
+				t.Errorf("ParseTime(%q).Seconds() = %g, want %g", tt.input, result.Seconds(), tt.seconds)
+			}
+		})
+	}
+}
+
+func TestNewTime(t *testing.T) {
+	if got := NewTime(1, -2).String(); got != "-1/2s" {
+		t.Errorf("NewTime(1, -2) = %q, want %q", got, "-1/2s")
+	}
+	if got := NewTime(-1, -2).String(); got != "1/2s" {
+		t.Errorf("NewTime(-1, -2) = %q, want %q", got, "1/2s")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected NewTime(1, 0) to panic")
+		}
+	}()
+	NewTime(1, 0)
+}
+
+func TestTime_Arithmetic(t *testing.T) {
+	parse := func(s string) Time {
+		result, err := ParseTime(s)
+		if err != nil {
+			t.Fatalf("ParseTime(%q) failed: %v", s, err)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name string
+		got  Time
+		want string
+	}{
+		{"add same timebase", parse("1001/30000s").Add(parse("2002/30000s")), "3003/30000s"},
+		{"add mixed timebases", parse("275843/144000s").Add(parse("5700/3000s")), "549443/144000s"},
+		{"subtract", parse("10s").Sub(parse("1001/30000s")), "298999/30000s"},
+		{"conform down to frame", parse("3600s").Conform(parse("1001/30000s")), "107999892/30000s"},
+		{"conform on frame", parse("3003/30000s").Conform(parse("1001/30000s")), "3003/30000s"},
+		{"add unrelated timebases", parse("1/6s").Add(parse("1/10s")), "4/15s"},
+		{"add a dividing timebase", parse("1/3s").Add(parse("1/6s")), "3/6s"},
+		{"add beyond 64 bits", parse("9223372036854775807/1s").Add(parse("1s")), "9223372036854775808s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %q, want %q", tt.got.String(), tt.want)
+			}
+		})
+	}
+
+	if parse("1001/30000s").Cmp(parse("1/30s")) != 1 {
+		t.Error("Expected 1001/30000s to be longer than 1/30s")
+	}
+	if parse("100/3000s").Cmp(parse("1/30s")) != 0 {
+		t.Error("Expected 100/3000s to equal 1/30s")
+	}
+}
+
+func TestTimeFromRationalTime(t *testing.T) {
+	ntsc := 30000.0 / 1001
+
+	tests := []struct {
+		name string
+		rt   opentime.RationalTime
+		want string
+	}{
+		{"whole frames", opentime.NewRationalTime(1200, 24), "1200/24s"},
+		{"ntsc frame", opentime.NewRationalTime(1, ntsc), "1001/30000s"},
+		{"ntsc frames", opentime.NewRationalTime(30, ntsc), "30030/30000s"},
+		{"ntsc whole seconds", opentime.NewRationalTime(3600*ntsc, ntsc), "3600s"},
+		{"sub-frame", opentime.NewRationalTime(1.5, 24), "1/16s"},
+		{"fcpx timebase", opentime.NewRationalTime(518405621, 144000), "518405621/144000s"},
+		{"no rate", opentime.RationalTime{}, "0s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeFromRationalTime(tt.rt).String(); got != tt.want {
+				t.Errorf("TimeFromRationalTime(%v) = %q, want %q", tt.rt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		rt       opentime.RationalTime
+		timebase int64
+		want     string
+	}{
+		{"frame timebase", opentime.NewRationalTime(1356.45+1e-10, 30), 3000, "135645/3000s"},
+		{"audio sample", opentime.NewRationalTime(30.0/48000, 30), 48000, "1/48000s"},
+		{"off the timebase", opentime.NewRationalTime(5621.0/4800, 30), 48000, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := snapTime(tt.rt, tt.timebase, timeTolerance)
+			if !ok {
+				if tt.want != "" {
+					t.Errorf("snapTime(%v, %d) failed, want %q", tt.rt, tt.timebase, tt.want)
+				}
+				return
+			}
+			if got.String() != tt.want {
+				t.Errorf("snapTime(%v, %d) = %q, want %q", tt.rt, tt.timebase, got.String(), tt.want)
+			}
+		})
+	}
+}
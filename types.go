@@ -51,12 +51,18 @@ type Sequence struct {
 	TCFormat   string   `xml:"tcFormat,attr,omitempty"`
 	AudioLayout string  `xml:"audioLayout,attr,omitempty"`
 	AudioRate  string   `xml:"audioRate,attr,omitempty"`
+	Note       *Note    `xml:"note,omitempty"`
 	Spine      *Spine   `xml:"spine,omitempty"`
+	Metadata   *Metadata `xml:"metadata,omitempty"`
 }
 
-// Spine represents the primary storyline/timeline.
+// Spine represents the primary storyline/timeline. Spines nested inside
+// clips are secondary storylines connected to the clip.
 type Spine struct {
 	XMLName xml.Name `xml:"spine"`
+	Name    string   `xml:"name,attr,omitempty"`
+	Lane    string   `xml:"lane,attr,omitempty"`
+	Offset  string   `xml:"offset,attr,omitempty"`
 	Items   []interface{}
 }
 
@@ -65,6 +71,17 @@ func (s *Spine) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	s.XMLName = start.Name
 	s.Items = make([]interface{}, 0)
 
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "name":
+			s.Name = attr.Value
+		case "lane":
+			s.Lane = attr.Value
+		case "offset":
+			s.Offset = attr.Value
+		}
+	}
+
 	for {
 		token, err := d.Token()
 		if err != nil {
@@ -73,23 +90,8 @@ func (s *Spine) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 		switch t := token.(type) {
 		case xml.StartElement:
-			var item interface{}
-			switch t.Name.Local {
-			case "asset-clip", "clip":
-				item = &Clip{}
-			case "video":
-				item = &Video{}
-			case "audio":
-				item = &Audio{}
-			case "gap":
-				item = &Gap{}
-			case "title":
-				item = &Title{}
-			case "transition":
-				item = &Transition{}
-			case "ref-clip":
-				item = &RefClip{}
-			default:
+			item := newStoryElement(t.Name.Local)
+			if item == nil {
 				// Skip unknown elements
 				if err := d.Skip(); err != nil {
 					return err
@@ -110,47 +112,140 @@ func (s *Spine) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	}
 }
 
+// newStoryElement returns an empty value for the story element with the given
+// element name, or nil if the element is not a supported story element.
+func newStoryElement(name string) interface{} {
+	switch name {
+	case "asset-clip", "clip":
+		return &Clip{}
+	case "video":
+		return &Video{}
+	case "audio":
+		return &Audio{}
+	case "gap":
+		return &Gap{}
+	case "title":
+		return &Title{}
+	case "caption":
+		return &Caption{}
+	case "transition":
+		return &Transition{}
+	case "ref-clip":
+		return &RefClip{}
+	case "mc-clip":
+		return &MCClip{}
+	case "sync-clip":
+		return &SyncClip{}
+	case "audition":
+		return &Audition{}
+	case "spine":
+		return &Spine{}
+	}
+	return nil
+}
+
+// StoryElements holds the story elements nested inside another story
+// element, such as the clips connected to it, in document order.
+type StoryElements []interface{}
+
+// UnmarshalXML implements custom XML unmarshaling for StoryElements. It is
+// called once for each nested element; unsupported elements are skipped.
+func (s *StoryElements) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	item := newStoryElement(start.Name.Local)
+	if item == nil {
+		return d.Skip()
+	}
+
+	if err := d.DecodeElement(item, &start); err != nil {
+		return err
+	}
+	*s = append(*s, item)
+
+	return nil
+}
+
 // Item is an interface for items that can appear in a spine or track.
 type Item interface{}
 
 // Clip represents a clip element (can be asset-clip, video, audio, etc).
+// XMLName records which of asset-clip or clip the element was; a Clip
+// without one is written as an asset-clip.
 type Clip struct {
-	XMLName      xml.Name  `xml:"asset-clip"`
+	XMLName      xml.Name
 	Name         string    `xml:"name,attr,omitempty"`
 	Ref          string    `xml:"ref,attr,omitempty"`
+	Lane         string    `xml:"lane,attr,omitempty"`
 	Offset       string    `xml:"offset,attr,omitempty"`
 	Start        string    `xml:"start,attr,omitempty"`
 	Duration     string    `xml:"duration,attr,omitempty"`
+	SrcEnable    string    `xml:"srcEnable,attr,omitempty"`
 	TCFormat     string    `xml:"tcFormat,attr,omitempty"`
 	AudioStart   string    `xml:"audioStart,attr,omitempty"`
 	AudioDuration string   `xml:"audioDuration,attr,omitempty"`
 	AudioRole    string    `xml:"audioRole,attr,omitempty"`
-	Markers      []*Marker `xml:"marker,omitempty"`
+	VideoRole    string    `xml:"videoRole,attr,omitempty"`
+	Note         *Note     `xml:"note,omitempty"`
+	ConformRate  *ConformRate `xml:"conform-rate,omitempty"`
+	TimeMap      *TimeMap  `xml:"timeMap,omitempty"`
 	Video        *Video    `xml:"video,omitempty"`
 	Audio        *Audio    `xml:"audio,omitempty"`
+	Items        StoryElements `xml:",any"`
+	Markers      []*Marker `xml:"marker,omitempty"`
+	ChapterMarkers []*ChapterMarker `xml:"chapter-marker,omitempty"`
+	Keywords       []*Keyword       `xml:"keyword,omitempty"`
+	Ratings        []*Rating        `xml:"rating,omitempty"`
+	FilterVideos []*FilterVideo `xml:"filter-video,omitempty"`
+	FilterAudios []*FilterAudio `xml:"filter-audio,omitempty"`
+	Metadata     *Metadata `xml:"metadata,omitempty"`
+}
+
+// MarshalXML implements custom XML marshaling for Clip, naming the element
+// after XMLName, or asset-clip when it is unset.
+func (c Clip) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// The local type has Clip's fields without this method
+	type clip Clip
+	if c.XMLName.Local == "" {
+		c.XMLName = xml.Name{Local: "asset-clip"}
+	}
+	start.Name = c.XMLName
+	return e.EncodeElement(clip(c), start)
 }
 
 // Video represents a video element.
 type Video struct {
-	XMLName  xml.Name  `xml:"video"`
-	Name     string    `xml:"name,attr,omitempty"`
-	Ref      string    `xml:"ref,attr,omitempty"`
-	Offset   string    `xml:"offset,attr,omitempty"`
-	Start    string    `xml:"start,attr,omitempty"`
-	Duration string    `xml:"duration,attr,omitempty"`
-	Markers  []*Marker `xml:"marker,omitempty"`
+	XMLName     xml.Name      `xml:"video"`
+	Name        string        `xml:"name,attr,omitempty"`
+	Ref         string        `xml:"ref,attr,omitempty"`
+	Lane        string        `xml:"lane,attr,omitempty"`
+	Offset      string        `xml:"offset,attr,omitempty"`
+	Start       string        `xml:"start,attr,omitempty"`
+	Duration    string        `xml:"duration,attr,omitempty"`
+	Role        string        `xml:"role,attr,omitempty"`
+	Params      []*Param      `xml:"param,omitempty"`
+	ConformRate *ConformRate  `xml:"conform-rate,omitempty"`
+	TimeMap     *TimeMap      `xml:"timeMap,omitempty"`
+	Items       StoryElements `xml:",any"`
+	Markers     []*Marker     `xml:"marker,omitempty"`
+	ChapterMarkers []*ChapterMarker `xml:"chapter-marker,omitempty"`
+	Keywords       []*Keyword       `xml:"keyword,omitempty"`
+	Ratings        []*Rating        `xml:"rating,omitempty"`
+	FilterVideos []*FilterVideo `xml:"filter-video,omitempty"`
 }
 
 // Audio represents an audio element.
 type Audio struct {
-	XMLName  xml.Name   `xml:"audio"`
-	Name     string     `xml:"name,attr,omitempty"`
-	Ref      string     `xml:"ref,attr,omitempty"`
-	Offset   string     `xml:"offset,attr,omitempty"`
-	Start    string     `xml:"start,attr,omitempty"`
-	Duration string     `xml:"duration,attr,omitempty"`
-	Role     string     `xml:"role,attr,omitempty"`
-	Channels []*Channel `xml:"audio-channel,omitempty"`
+	XMLName  xml.Name      `xml:"audio"`
+	Name     string        `xml:"name,attr,omitempty"`
+	Ref      string        `xml:"ref,attr,omitempty"`
+	Lane     string        `xml:"lane,attr,omitempty"`
+	Offset   string        `xml:"offset,attr,omitempty"`
+	Start    string        `xml:"start,attr,omitempty"`
+	Duration string        `xml:"duration,attr,omitempty"`
+	Role     string        `xml:"role,attr,omitempty"`
+	TimeMap  *TimeMap      `xml:"timeMap,omitempty"`
+	Channels []*Channel    `xml:"audio-channel,omitempty"`
+	Items    StoryElements `xml:",any"`
+	FilterAudios []*FilterAudio `xml:"filter-audio,omitempty"`
 }
 
 // Channel represents an audio channel element.
@@ -162,33 +257,185 @@ type Channel struct {
 	Duration string   `xml:"duration,attr,omitempty"`
 }
 
+// ConformRate represents a conform-rate element, describing how a clip's
+// source frame rate is conformed to the sequence's.
+type ConformRate struct {
+	XMLName       xml.Name `xml:"conform-rate"`
+	ScaleEnabled  string   `xml:"scaleEnabled,attr,omitempty"`
+	SrcFrameRate  string   `xml:"srcFrameRate,attr,omitempty"`
+	FrameSampling string   `xml:"frameSampling,attr,omitempty"`
+}
+
+// TimeMap represents a timeMap element, which retimes a clip by mapping
+// clip time to source time.
+type TimeMap struct {
+	XMLName        xml.Name     `xml:"timeMap"`
+	FrameSampling  string       `xml:"frameSampling,attr,omitempty"`
+	PreservesPitch string       `xml:"preservesPitch,attr,omitempty"`
+	TimePoints     []*TimePoint `xml:"timept,omitempty"`
+}
+
+// TimePoint represents a timept element within a timeMap.
+type TimePoint struct {
+	XMLName xml.Name `xml:"timept"`
+	Time    string   `xml:"time,attr"`
+	Value   string   `xml:"value,attr"`
+	Interp  string   `xml:"interp,attr,omitempty"`
+	InTime  string   `xml:"inTime,attr,omitempty"`
+	OutTime string   `xml:"outTime,attr,omitempty"`
+}
+
 // Gap represents a gap (filler) element.
 type Gap struct {
-	XMLName  xml.Name `xml:"gap"`
-	Name     string   `xml:"name,attr,omitempty"`
-	Offset   string   `xml:"offset,attr,omitempty"`
-	Start    string   `xml:"start,attr,omitempty"`
-	Duration string   `xml:"duration,attr,omitempty"`
+	XMLName  xml.Name      `xml:"gap"`
+	Name     string        `xml:"name,attr,omitempty"`
+	Lane     string        `xml:"lane,attr,omitempty"`
+	Offset   string        `xml:"offset,attr,omitempty"`
+	Start    string        `xml:"start,attr,omitempty"`
+	Duration string        `xml:"duration,attr,omitempty"`
+	Items    StoryElements `xml:",any"`
 }
 
-// Marker represents a marker element.
+// Marker represents a marker element. To-do markers have a completed
+// attribute, which standard markers lack: ToDo records that a marker is a
+// to-do, and a Completed marker is always one.
 type Marker struct {
 	XMLName  xml.Name `xml:"marker"`
 	Start    string   `xml:"start,attr,omitempty"`
 	Duration string   `xml:"duration,attr,omitempty"`
 	Value    string   `xml:"value,attr,omitempty"`
 	Note     string   `xml:"note,attr,omitempty"`
-	Completed bool    `xml:"completed,attr,omitempty"`
+	Completed bool    `xml:"-"`
+	ToDo     bool     `xml:"-"`
+}
+
+// markerElement is the XML form of a Marker, with its completed attribute
+// as written.
+type markerElement struct {
+	XMLName   xml.Name `xml:"marker"`
+	Start     string   `xml:"start,attr,omitempty"`
+	Duration  string   `xml:"duration,attr,omitempty"`
+	Value     string   `xml:"value,attr,omitempty"`
+	Note      string   `xml:"note,attr,omitempty"`
+	Completed string   `xml:"completed,attr,omitempty"`
+}
+
+// UnmarshalXML implements custom XML unmarshaling for Marker.
+func (m *Marker) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var element markerElement
+	if err := d.DecodeElement(&element, &start); err != nil {
+		return err
+	}
+	*m = Marker{
+		XMLName:   element.XMLName,
+		Start:     element.Start,
+		Duration:  element.Duration,
+		Value:     element.Value,
+		Note:      element.Note,
+		Completed: element.Completed == "1" || element.Completed == "true",
+		ToDo:      element.Completed != "",
+	}
+	return nil
+}
+
+// MarshalXML implements custom XML marshaling for Marker, writing the
+// completed attribute of to-do markers only.
+func (m Marker) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	element := markerElement{
+		Start:    m.Start,
+		Duration: m.Duration,
+		Value:    m.Value,
+		Note:     m.Note,
+	}
+	switch {
+	case m.Completed:
+		element.Completed = "1"
+	case m.ToDo:
+		element.Completed = "0"
+	}
+	start.Name = xml.Name{Local: "marker"}
+	return e.EncodeElement(element, start)
+}
+
+// ChapterMarker represents a chapter-marker element. PosterOffset is the
+// time, relative to the marker, of the frame used as the chapter's poster.
+type ChapterMarker struct {
+	XMLName      xml.Name `xml:"chapter-marker"`
+	Start        string   `xml:"start,attr,omitempty"`
+	Duration     string   `xml:"duration,attr,omitempty"`
+	Value        string   `xml:"value,attr,omitempty"`
+	Note         string   `xml:"note,attr,omitempty"`
+	PosterOffset string   `xml:"posterOffset,attr,omitempty"`
 }
 
 // Title represents a title element.
 type Title struct {
-	XMLName  xml.Name `xml:"title"`
-	Name     string   `xml:"name,attr,omitempty"`
-	Ref      string   `xml:"ref,attr,omitempty"`
-	Offset   string   `xml:"offset,attr,omitempty"`
-	Start    string   `xml:"start,attr,omitempty"`
-	Duration string   `xml:"duration,attr,omitempty"`
+	XMLName  xml.Name      `xml:"title"`
+	Name     string        `xml:"name,attr,omitempty"`
+	Ref      string        `xml:"ref,attr,omitempty"`
+	Lane     string        `xml:"lane,attr,omitempty"`
+	Offset   string        `xml:"offset,attr,omitempty"`
+	Start    string        `xml:"start,attr,omitempty"`
+	Duration string        `xml:"duration,attr,omitempty"`
+	Role     string        `xml:"role,attr,omitempty"`
+	Params   []*Param      `xml:"param,omitempty"`
+	Texts    []*Text       `xml:"text,omitempty"`
+	TextStyleDefs []*TextStyleDef `xml:"text-style-def,omitempty"`
+	Items    StoryElements `xml:",any"`
+	FilterVideos []*FilterVideo `xml:"filter-video,omitempty"`
+}
+
+// Caption represents a caption element. Its role names the caption format
+// and language, such as "iTT?captionFormat=ITT.en".
+type Caption struct {
+	XMLName       xml.Name        `xml:"caption"`
+	Name          string          `xml:"name,attr,omitempty"`
+	Lane          string          `xml:"lane,attr,omitempty"`
+	Offset        string          `xml:"offset,attr,omitempty"`
+	Start         string          `xml:"start,attr,omitempty"`
+	Duration      string          `xml:"duration,attr,omitempty"`
+	Role          string          `xml:"role,attr,omitempty"`
+	Texts         []*Text         `xml:"text,omitempty"`
+	TextStyleDefs []*TextStyleDef `xml:"text-style-def,omitempty"`
+	Items         StoryElements   `xml:",any"`
+}
+
+// Text represents the text of a title or caption, made of runs that each
+// use a text style. The display attributes are only used by captions.
+type Text struct {
+	XMLName      xml.Name     `xml:"text"`
+	DisplayStyle string       `xml:"display-style,attr,omitempty"`
+	RollUpHeight string       `xml:"roll-up-height,attr,omitempty"`
+	Position     string       `xml:"position,attr,omitempty"`
+	Placement    string       `xml:"placement,attr,omitempty"`
+	Alignment    string       `xml:"alignment,attr,omitempty"`
+	TextStyles   []*TextStyle `xml:"text-style,omitempty"`
+}
+
+// TextStyle represents a text-style element. Inside a text element it is a
+// run of text using the style defined by Ref; inside a text-style-def it
+// holds the style's attributes.
+type TextStyle struct {
+	XMLName     xml.Name `xml:"text-style"`
+	Ref         string   `xml:"ref,attr,omitempty"`
+	Font        string   `xml:"font,attr,omitempty"`
+	FontSize    string   `xml:"fontSize,attr,omitempty"`
+	FontFace    string   `xml:"fontFace,attr,omitempty"`
+	FontColor   string   `xml:"fontColor,attr,omitempty"`
+	Bold        string   `xml:"bold,attr,omitempty"`
+	Italic      string   `xml:"italic,attr,omitempty"`
+	Alignment   string   `xml:"alignment,attr,omitempty"`
+	LineSpacing string   `xml:"lineSpacing,attr,omitempty"`
+	BackgroundColor string `xml:"backgroundColor,attr,omitempty"`
+	Text        string   `xml:",chardata"`
+}
+
+// TextStyleDef represents a text-style-def element, defining a text style
+// that a title's text refers to by id.
+type TextStyleDef struct {
+	XMLName   xml.Name   `xml:"text-style-def"`
+	ID        string     `xml:"id,attr,omitempty"`
+	TextStyle *TextStyle `xml:"text-style,omitempty"`
 }
 
 // Transition represents a transition element.
@@ -201,28 +448,54 @@ type Transition struct {
 	FilterAudio *FilterAudio  `xml:"filter-audio,omitempty"`
 }
 
-// FilterVideo represents a filter-video element within a transition.
+// FilterVideo represents a filter-video element within a transition or on a
+// clip. Enabled is "0" for a filter that is turned off.
 type FilterVideo struct {
 	XMLName xml.Name `xml:"filter-video"`
 	Ref     string   `xml:"ref,attr,omitempty"`
 	Name    string   `xml:"name,attr,omitempty"`
+	Enabled string   `xml:"enabled,attr,omitempty"`
 	Params  []*Param `xml:"param,omitempty"`
 }
 
-// FilterAudio represents a filter-audio element within a transition.
+// FilterAudio represents a filter-audio element within a transition or on a
+// clip. Enabled is "0" for a filter that is turned off.
 type FilterAudio struct {
 	XMLName xml.Name `xml:"filter-audio"`
 	Ref     string   `xml:"ref,attr,omitempty"`
 	Name    string   `xml:"name,attr,omitempty"`
+	Enabled string   `xml:"enabled,attr,omitempty"`
 	Params  []*Param `xml:"param,omitempty"`
 }
 
-// Param represents a parameter element within a filter.
+// Param represents a parameter element within a filter. Animated params
+// hold their keyframes, and grouped params, such as those of a color board,
+// nest their members.
 type Param struct {
-	XMLName xml.Name `xml:"param"`
-	Name    string   `xml:"name,attr,omitempty"`
-	Key     string   `xml:"key,attr,omitempty"`
-	Value   string   `xml:"value,attr,omitempty"`
+	XMLName           xml.Name           `xml:"param"`
+	Name              string             `xml:"name,attr,omitempty"`
+	Key               string             `xml:"key,attr,omitempty"`
+	Value             string             `xml:"value,attr,omitempty"`
+	Enabled           string             `xml:"enabled,attr,omitempty"`
+	KeyframeAnimation *KeyframeAnimation `xml:"keyframeAnimation,omitempty"`
+	Params            []*Param           `xml:"param,omitempty"`
+}
+
+// KeyframeAnimation represents the keyframeAnimation element of an animated
+// param.
+type KeyframeAnimation struct {
+	XMLName   xml.Name    `xml:"keyframeAnimation"`
+	Keyframes []*Keyframe `xml:"keyframe,omitempty"`
+}
+
+// Keyframe represents a keyframe element, the param's value at a time in
+// the filtered element's local time.
+type Keyframe struct {
+	XMLName xml.Name `xml:"keyframe"`
+	Time    string   `xml:"time,attr"`
+	Value   string   `xml:"value,attr"`
+	Interp  string   `xml:"interp,attr,omitempty"`
+	Curve   string   `xml:"curve,attr,omitempty"`
 }
 
 // Effect represents an effect element in resources.
@@ -233,7 +506,7 @@ type Effect struct {
 	UID     string   `xml:"uid,attr,omitempty"`
 }
 
-// Media represents a media element (compound clip).
+// Media represents a media element (compound or multicam clip).
 type Media struct {
 	XMLName  xml.Name  `xml:"media"`
 	ID       string    `xml:"id,attr,omitempty"`
@@ -241,6 +514,25 @@ type Media struct {
 	UID      string    `xml:"uid,attr,omitempty"`
 	ModDate  string    `xml:"modDate,attr,omitempty"`
 	Sequence *Sequence `xml:"sequence,omitempty"`
+	Multicam *Multicam `xml:"multicam,omitempty"`
+}
+
+// Multicam represents a multicam element, the angles of a multicam clip.
+type Multicam struct {
+	XMLName  xml.Name   `xml:"multicam"`
+	Format   string     `xml:"format,attr,omitempty"`
+	TCStart  string     `xml:"tcStart,attr,omitempty"`
+	TCFormat string     `xml:"tcFormat,attr,omitempty"`
+	Angles   []*MCAngle `xml:"mc-angle,omitempty"`
+}
+
+// MCAngle represents an mc-angle element. Its items play one after another
+// like those of a spine.
+type MCAngle struct {
+	XMLName xml.Name      `xml:"mc-angle"`
+	Name    string        `xml:"name,attr,omitempty"`
+	AngleID string        `xml:"angleID,attr,omitempty"`
+	Items   StoryElements `xml:",any"`
 }
 
 // RefClip represents a ref-clip element (reference to compound clip).
@@ -248,12 +540,100 @@ type RefClip struct {
 	XMLName         xml.Name  `xml:"ref-clip"`
 	Name            string    `xml:"name,attr,omitempty"`
 	Ref             string    `xml:"ref,attr,omitempty"`
+	Lane            string    `xml:"lane,attr,omitempty"`
 	Offset          string    `xml:"offset,attr,omitempty"`
 	Start           string    `xml:"start,attr,omitempty"`
 	Duration        string    `xml:"duration,attr,omitempty"`
 	SrcEnable       string    `xml:"srcEnable,attr,omitempty"`
+	VideoRole       string    `xml:"videoRole,attr,omitempty"`
 	UseAudioSubroles bool     `xml:"useAudioSubroles,attr,omitempty"`
+	Note            *Note     `xml:"note,omitempty"`
+	ConformRate     *ConformRate `xml:"conform-rate,omitempty"`
+	TimeMap         *TimeMap  `xml:"timeMap,omitempty"`
+	Items           StoryElements `xml:",any"`
 	Markers         []*Marker `xml:"marker,omitempty"`
+	ChapterMarkers []*ChapterMarker `xml:"chapter-marker,omitempty"`
+	Keywords       []*Keyword       `xml:"keyword,omitempty"`
+	Ratings        []*Rating        `xml:"rating,omitempty"`
+	FilterVideos    []*FilterVideo `xml:"filter-video,omitempty"`
+	FilterAudios    []*FilterAudio `xml:"filter-audio,omitempty"`
+	Metadata        *Metadata `xml:"metadata,omitempty"`
+}
+
+// MCClip represents an mc-clip element (use of a multicam clip).
+type MCClip struct {
+	XMLName     xml.Name      `xml:"mc-clip"`
+	Name        string        `xml:"name,attr,omitempty"`
+	Ref         string        `xml:"ref,attr,omitempty"`
+	Lane        string        `xml:"lane,attr,omitempty"`
+	Offset      string        `xml:"offset,attr,omitempty"`
+	Start       string        `xml:"start,attr,omitempty"`
+	Duration    string        `xml:"duration,attr,omitempty"`
+	Note        *Note         `xml:"note,omitempty"`
+	ConformRate *ConformRate  `xml:"conform-rate,omitempty"`
+	TimeMap     *TimeMap      `xml:"timeMap,omitempty"`
+	Sources     []*MCSource   `xml:"mc-source,omitempty"`
+	Items       StoryElements `xml:",any"`
+	Markers     []*Marker     `xml:"marker,omitempty"`
+	ChapterMarkers []*ChapterMarker `xml:"chapter-marker,omitempty"`
+	Keywords       []*Keyword       `xml:"keyword,omitempty"`
+	Ratings        []*Rating        `xml:"rating,omitempty"`
+	FilterVideos []*FilterVideo `xml:"filter-video,omitempty"`
+	FilterAudios []*FilterAudio `xml:"filter-audio,omitempty"`
+	Metadata    *Metadata     `xml:"metadata,omitempty"`
+}
+
+// SyncClip represents a sync-clip element, a clip synced with separately
+// recorded audio. Its items hold the synced video and audio.
+type SyncClip struct {
+	XMLName     xml.Name      `xml:"sync-clip"`
+	Name        string        `xml:"name,attr,omitempty"`
+	Lane        string        `xml:"lane,attr,omitempty"`
+	Offset      string        `xml:"offset,attr,omitempty"`
+	Start       string        `xml:"start,attr,omitempty"`
+	Duration    string        `xml:"duration,attr,omitempty"`
+	TCFormat    string        `xml:"tcFormat,attr,omitempty"`
+	Note        *Note         `xml:"note,omitempty"`
+	Items       StoryElements `xml:",any"`
+	Markers     []*Marker     `xml:"marker,omitempty"`
+	ChapterMarkers []*ChapterMarker `xml:"chapter-marker,omitempty"`
+	Keywords       []*Keyword       `xml:"keyword,omitempty"`
+	Ratings        []*Rating        `xml:"rating,omitempty"`
+	SyncSources []*SyncSource `xml:"sync-source,omitempty"`
+	Metadata    *Metadata     `xml:"metadata,omitempty"`
+}
+
+// SyncSource represents a sync-source element, configuring the audio of
+// either the clip's storyline or its connected clips.
+type SyncSource struct {
+	XMLName          xml.Name           `xml:"sync-source"`
+	SourceID         string             `xml:"sourceID,attr"`
+	AudioRoleSources []*AudioRoleSource `xml:"audio-role-source,omitempty"`
+}
+
+// AudioRoleSource represents an audio-role-source element.
+type AudioRoleSource struct {
+	XMLName xml.Name `xml:"audio-role-source"`
+	Role    string   `xml:"role,attr,omitempty"`
+	Active  string   `xml:"active,attr,omitempty"`
+}
+
+// Audition represents an audition element. Its first item is the active
+// pick, the others are alternates.
+type Audition struct {
+	XMLName xml.Name      `xml:"audition"`
+	Lane    string        `xml:"lane,attr,omitempty"`
+	Offset  string        `xml:"offset,attr,omitempty"`
+	ModDate string        `xml:"modDate,attr,omitempty"`
+	Items   StoryElements `xml:",any"`
+}
+
+// MCSource represents an mc-source element, selecting the angle an mc-clip
+// uses for its video, audio or both.
+type MCSource struct {
+	XMLName   xml.Name `xml:"mc-source"`
+	AngleID   string   `xml:"angleID,attr,omitempty"`
+	SrcEnable string   `xml:"srcEnable,attr,omitempty"`
 }
 
 // Keyword represents a keyword element.
@@ -262,6 +642,18 @@ type Keyword struct {
 	Start    string   `xml:"start,attr,omitempty"`
 	Duration string   `xml:"duration,attr,omitempty"`
 	Value    string   `xml:"value,attr,omitempty"`
+	Note     string   `xml:"note,attr,omitempty"`
+}
+
+// Rating represents a rating element, marking a range of a clip as a
+// favorite or reject.
+type Rating struct {
+	XMLName  xml.Name `xml:"rating"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Start    string   `xml:"start,attr,omitempty"`
+	Duration string   `xml:"duration,attr,omitempty"`
+	Value    string   `xml:"value,attr,omitempty"`
+	Note     string   `xml:"note,attr,omitempty"`
 }
 
 // Note represents a note element.
@@ -276,11 +668,19 @@ type Metadata struct {
 	MD      []*MD    `xml:"md,omitempty"`
 }
 
-// MD represents a metadata key-value pair.
+// MD represents a metadata key-value pair. Multi-valued entries, such as
+// a file's codecs, hold their values in an array instead.
 type MD struct {
 	XMLName xml.Name `xml:"md"`
 	Key     string   `xml:"key,attr,omitempty"`
 	Value   string   `xml:"value,attr,omitempty"`
+	Array   *MDArray `xml:"array,omitempty"`
+}
+
+// MDArray represents the array of string values of an md element.
+type MDArray struct {
+	XMLName xml.Name `xml:"array"`
+	Strings []string `xml:"string"`
 }
 
 // Resources represents the resources element.
@@ -318,4 +718,14 @@ type Asset struct {
 	AudioSources  string   `xml:"audioSources,attr,omitempty"`
 	AudioChannels string   `xml:"audioChannels,attr,omitempty"`
 	AudioRate     string   `xml:"audioRate,attr,omitempty"`
+	MediaReps     []*MediaRep `xml:"media-rep,omitempty"`
+	Metadata      *Metadata `xml:"metadata,omitempty"`
+}
+
+// MediaRep represents a media-rep element, which locates an asset's media
+// from FCPXML 1.9 on.
+type MediaRep struct {
+	XMLName xml.Name `xml:"media-rep"`
+	Kind    string   `xml:"kind,attr,omitempty"`
+	Src     string   `xml:"src,attr,omitempty"`
 }